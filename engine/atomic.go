@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"math/bits"
+)
+
+/*
+ * Atomic: a capture is an explosion on the capture square, which removes the capturing piece, the captured piece
+ * and all the pieces except pawns on the squares around it. Exploding the enemy King win the game, so:
+ * - A King can't capture, and a move that explode its own King is illegal
+ * - Kings can stand next to each other, and then there is no check: capturing the other King would explode its own
+ * The pins of standard chess don't hold anymore (a pinned piece can explode the attacker's King), so the moves are
+ * generated pseudo legal, then played and kept if the King survives and is not in check (or the enemy King is gone)
+ */
+
+// Check if both Kings are on the board and next to each other
+func (chess *Chess) kingsTouch() bool {
+	white, black := chess.Boards[WHITE_KING], chess.Boards[BLACK_KING]
+	return white != 0 && black != 0 && KING_ATTACK[bits.TrailingZeros64(white)]&black != 0
+}
+
+// Explode the capture square: remove the piece that captured and all the pieces except pawns around it.
+// A Rook or a King that explode lose its castling privileges
+func (chess *Chess) explode(index int) {
+	blast := KING_ATTACK[index]
+	for piece := WHITE_PAWN; piece <= BLACK_KING; piece++ {
+		board := chess.Boards[piece] & (uint64(1) << index)
+		if piece != WHITE_PAWN && piece != BLACK_PAWN {
+			board |= chess.Boards[piece] & blast
+		}
+		for board != 0 {
+			square := bits.TrailingZeros64(board)
+			ClearBit(square, &chess.Boards[piece])
+			chess.updatePiece(piece, square)
+			ClearBit(square, &board)
+		}
+	}
+
+	blast |= uint64(1) << index
+	chess.hashCastling(chess.CastlingPrivilege)
+	for _, cs := range []int{WHITE_KING_SIDE, WHITE_QUEEN_SIDE, BLACK_KING_SIDE, BLACK_QUEEN_SIDE} {
+		if IsPieceAtIndex(blast, chess.CastlingRooks[castlingIndex(cs)]) {
+			chess.CastlingPrivilege &^= cs
+		}
+	}
+	if chess.Boards[WHITE_KING] == 0 {
+		chess.CastlingPrivilege &= 3
+	}
+	if chess.Boards[BLACK_KING] == 0 {
+		chess.CastlingPrivilege &= 12
+	}
+	chess.hashCastling(chess.CastlingPrivilege)
+}
+
+// Generate the legal moves of White in Atomic
+func (chess *Chess) AtomicMoveGeneration() []Move {
+	var (
+		wp, wr, wn, wb, wq = chess.Boards[WHITE_PAWN], chess.Boards[WHITE_ROOK], chess.Boards[WHITE_KNIGHT],
+			chess.Boards[WHITE_BISHOP], chess.Boards[WHITE_QUEEN]
+		empty          = ^(chess.GenerateAllWhites() | chess.GenerateAllBlacks())
+		FILE_A, FILE_H = FILE_MASK[0], FILE_MASK[7]
+		pseudo         []Move
+		moves          []Move
+	)
+
+	//The moves of the pieces. Capturing the enemy King is never possible: it's only attacked when the Kings touch
+	for _, move := range chess.PseudoLegalMoves(wp, wr, wn, wb, wq) {
+		if !IsPieceAtIndex(chess.Boards[BLACK_KING], move.ToIndex) {
+			pseudo = append(pseudo, move)
+		}
+	}
+
+	//The King can't capture
+	if chess.Boards[WHITE_KING] != 0 {
+		kingIndex := bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		kingMoves := KING_ATTACK[kingIndex] & empty
+		for kingMoves != 0 {
+			index := bits.TrailingZeros64(kingMoves)
+			pseudo = append(pseudo, Move{FromBoard: WHITE_KING, FromIndex: kingIndex, ToBoard: WHITE_KING, ToIndex: index})
+			ClearBit(index, &kingMoves)
+		}
+	}
+
+	//En passant, the explosion is on the target square
+	if 40 <= chess.EnPassantTarget && chess.EnPassantTarget <= 47 {
+		epMove := ((uint64(1) << chess.EnPassantTarget) >> 9) & wp & ^FILE_A
+		epMove |= ((uint64(1) << chess.EnPassantTarget) >> 7) & wp & ^FILE_H
+		for epMove != 0 {
+			index := bits.TrailingZeros64(epMove)
+			pseudo = append(pseudo, Move{FromBoard: WHITE_PAWN, FromIndex: index, ToBoard: WHITE_PAWN, ToIndex: chess.EnPassantTarget})
+			ClearBit(index, &epMove)
+		}
+	}
+
+	//Castling, only when not in check
+	if !chess.IsWhiteKingChecked() {
+		for _, cs := range []int{WHITE_KING_SIDE, WHITE_QUEEN_SIDE} {
+			if move, ok := chess.WhiteCastlingMove(cs); ok {
+				pseudo = append(pseudo, move)
+			}
+		}
+	}
+
+	//Keep the moves after which the King is still there, and not in check unless the enemy King exploded
+	for _, move := range pseudo {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		if clone.Boards[WHITE_KING] != 0 && (clone.Boards[BLACK_KING] == 0 || !clone.IsWhiteKingChecked()) {
+			moves = append(moves, move)
+		}
+	}
+
+	return moves
+}
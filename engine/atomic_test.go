@@ -0,0 +1,31 @@
+package engine
+
+import "testing"
+
+// Same Perft as the test command of the CLI
+func TestAtomicPerft(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		nodes []int // Perft from depth 1
+	}{
+		{"start", "", []int{20, 400, 8902, 197326, 4864979}},
+		{"middlegame, Black to move", "rn2kb1r/1pp1p2p/p2q1pp1/3P4/2P3b1/4PN2/PP3PPP/R2QKB1R b KQkq - 0 1", []int{40, 1238, 45237}},
+		{"middlegame, White to move", "rn1qkb1r/p5pp/2p5/3p4/N3P3/5P2/PPP4P/R1BQK3 w Qkq - 0 1", []int{28, 833, 23353}},
+		{"castling", "8/8/8/8/8/8/2k5/rR4KR w KQ - 0 1", []int{18, 180, 4364}},
+	}
+
+	for _, test := range tests {
+		chess := NewChess()
+		chess.Variant = ATOMIC
+		chess.FEN(test.fen)
+		for depth, nodes := range test.nodes {
+			if depth >= 4 && testing.Short() {
+				break
+			}
+			if count := chess.Perft(depth + 1); count != nodes {
+				t.Errorf("%s: Perft(%d) = %d, want %d", test.name, depth+1, count, nodes)
+			}
+		}
+	}
+}
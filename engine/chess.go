@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"math/bits"
 	"strconv"
 	"strings"
 )
@@ -10,10 +11,21 @@ import (
 type Chess struct {
 	Boards            [12]uint64
 	SideToMove        int
-	EnPassantTarget   int // Range from 0 to 63
-	CastlingPrivilege int // Use 4 bit integer to represent: KQkq (exactly in this order)
+	EnPassantTarget   int    // Range from 0 to 63
+	CastlingPrivilege int    // Use 4 bit integer to represent: KQkq (exactly in this order)
+	CastlingRooks     [4]int // Initial square of the Rook of each castling privilege: K, Q, k, q (any file in Chess960)
 	Halfmove          int
 	Fullmove          int
+	history           *historyNode // Positions since the last irreversible move (pawn move or capture), newest first
+	hash, mirror      uint64       // Zobrist hash of the position and of the flipped position, kept up to date by MakeMove and Flip
+	Params            *EvalParams  // Evaluation parameters, nil for the default parameters
+	network           *Network     // NNUE network used by Evaluate, nil for the handcrafted evaluation
+	accumulator       *Accumulator // NNUE accumulators, kept up to date by MakeMove and Flip
+	Tablebase         *Tablebase   // Syzygy tablebases probed by the search, nil for none
+	Variant           Variant      // Rules of the game (see variant.go), kept by FEN and Clear
+	Checks            [2]int       // Checks given by White and by Black (Three-check)
+	Pockets           [2][5]int    // Pieces in hand of White and Black, indexed by board from pawn to queen (Crazyhouse)
+	Promoted          uint64       // Pieces that were promoted, they go back to the pocket as pawns (Crazyhouse)
 }
 
 func NewChess() *Chess {
@@ -22,8 +34,9 @@ func NewChess() *Chess {
 		SideToMove:        WHITE,        //White turn as default
 		EnPassantTarget:   -1,           //No en passant target
 		CastlingPrivilege: 0,            //No castling privilege
-		Halfmove:          0,            //Default halfmove
-		Fullmove:          1,            //Default fullmove
+		CastlingRooks:     DEFAULT_CASTLING_ROOKS,
+		Halfmove:          0, //Default halfmove
+		Fullmove:          1, //Default fullmove
 	}
 }
 
@@ -33,22 +46,35 @@ func (chess *Chess) Clear() {
 	}
 	chess.EnPassantTarget = -1
 	chess.CastlingPrivilege = 0
+	chess.CastlingRooks = DEFAULT_CASTLING_ROOKS
 	chess.SideToMove = WHITE
 	chess.Halfmove = 0
 	chess.Fullmove = 1
+	chess.Checks = [2]int{}
+	chess.Pockets = [2][5]int{}
+	chess.Promoted = 0
+	chess.history = nil
+	chess.resetHash()
+	chess.refreshAccumulator()
 }
 
 func (chess *Chess) FEN(fen string) {
 	//Clear the old data of chess object (in case of replay)
 	chess.Clear()
 
-	//If empty string is provided, then we assumed it to be default position
+	//If empty string is provided, then we assumed it to be default position (of the variant)
 	if len(fen) == 0 || fen == "" {
-		fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" //Starting position
+		fen = chess.Variant.StartFEN() //Starting position
 	}
 
-	//Split the fen string
-	data := strings.Split(fen, " ")
+	//Split the fen string. The checks of Three-check are in their own field, which is removed here
+	data := strings.Fields(fen)
+	for i := 4; i < len(data); i++ {
+		if chess.parseChecks(data[i]) {
+			data = append(data[:i], data[i+1:]...)
+			break
+		}
+	}
 
 	//Set up the bitboards
 	pieceMapping := map[rune]int{
@@ -65,10 +91,23 @@ func (chess *Chess) FEN(fen string) {
 		'q': BLACK_QUEEN,
 		'k': BLACK_KING,
 	}
+	//The Crazyhouse pocket follow the board, between brackets (RNBQKBNR[Qn]) or as a ninth rank (RNBQKBNR/Qn)
+	board := data[0]
+	if i := strings.IndexByte(board, '['); i != -1 {
+		chess.parsePocket(strings.TrimSuffix(board[i+1:], "]"))
+		board = board[:i]
+	} else if strings.Count(board, "/") == 8 {
+		i := strings.LastIndexByte(board, '/')
+		chess.parsePocket(board[i+1:])
+		board = board[:i]
+	}
+
 	boardIndex := 63
-	for _, piece := range data[0] {
+	for _, piece := range board {
 		if '1' <= piece && piece <= '8' { //A valid syntax FEN string can only have digit from 1 to 8
 			boardIndex -= int(piece - '0')
+		} else if piece == '~' { //Promoted piece of Crazyhouse
+			SetBit(boardIndex+1, &chess.Promoted)
 		} else {
 			if piece != '/' {
 				chess.Boards[pieceMapping[piece]] |= 0x1 << boardIndex
@@ -84,20 +123,13 @@ func (chess *Chess) FEN(fen string) {
 		chess.SideToMove = BLACK
 	}
 
-	//Calculate castling privilege
+	//Calculate castling privilege. Besides KQkq, Chess960 positions can give the file of the Rook (Shredder-FEN: HAha,
+	//X-FEN: when the Rook is not the outermost one)
 	if data[2] == "-" {
 		chess.CastlingPrivilege = 0
 	} else {
 		for _, cs := range data[2] {
-			if cs == 'K' {
-				chess.CastlingPrivilege |= 8
-			} else if cs == 'Q' {
-				chess.CastlingPrivilege |= 4
-			} else if cs == 'k' {
-				chess.CastlingPrivilege |= 2
-			} else if cs == 'q' {
-				chess.CastlingPrivilege |= 1
-			}
+			chess.setCastlingPrivilege(cs)
 		}
 	}
 
@@ -109,6 +141,8 @@ func (chess *Chess) FEN(fen string) {
 	}
 
 	//If the FEN string didn't provide the halfmove and fullmove value, we'll assign fallback value to them
+	chess.resetHash()
+	chess.refreshAccumulator()
 	if len(data) <= 4 {
 		chess.Halfmove = 0
 		chess.Fullmove = 1
@@ -123,10 +157,266 @@ func (chess *Chess) FEN(fen string) {
 	}
 
 	//Register full move counter
-	chess.Fullmove, err = strconv.Atoi(data[5])
-	if err != nil {
-		chess.Fullmove = 1
+	chess.Fullmove = 1
+	if len(data) > 5 {
+		if chess.Fullmove, err = strconv.Atoi(data[5]); err != nil {
+			chess.Fullmove = 1
+		}
+	}
+}
+
+// Check that a FEN string can be loaded by FEN for the variant: the fields, the 8 ranks of 8 squares, the Kings (one
+// per side, except the missing King of the Horde and the exploded King of Atomic), no pawn on the last ranks and the
+// side not to move not in check. An empty string is the starting position
+func ValidateFEN(variant Variant, fen string) error {
+	if fen == "" {
+		return nil
+	}
+
+	chess := NewChess()
+	chess.Variant = variant
+	data := strings.Fields(fen)
+	for i := 4; i < len(data); i++ {
+		if variant == THREE_CHECK && chess.parseChecks(data[i]) {
+			data = append(data[:i], data[i+1:]...)
+			break
+		}
+	}
+	if len(data) < 4 || len(data) > 6 {
+		return fmt.Errorf("invalid FEN '%s': %d fields instead of 4 to 6", fen, len(data))
+	}
+
+	//Board, with the pocket of Crazyhouse
+	board := data[0]
+	if i := strings.IndexByte(board, '['); i != -1 && variant == CRAZYHOUSE {
+		if !strings.HasSuffix(board, "]") || strings.Trim(board[i+1:len(board)-1], "PRNBQprnbq-") != "" {
+			return fmt.Errorf("invalid FEN '%s': bad pocket", fen)
+		}
+		board = board[:i]
+	} else if strings.Count(board, "/") == 8 && variant == CRAZYHOUSE {
+		i := strings.LastIndexByte(board, '/')
+		if strings.Trim(board[i+1:], "PRNBQprnbq-") != "" {
+			return fmt.Errorf("invalid FEN '%s': bad pocket", fen)
+		}
+		board = board[:i]
+	}
+	ranks := strings.Split(board, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("invalid FEN '%s': %d ranks instead of 8", fen, len(ranks))
+	}
+	for i, rank := range ranks {
+		squares := 0
+		for j, c := range rank {
+			switch {
+			case '1' <= c && c <= '8':
+				squares += int(c - '0')
+			case strings.ContainsRune("PRNBQKprnbqk", c):
+				squares++
+			case c == '~' && variant == CRAZYHOUSE && j > 0 && strings.ContainsRune("RNBQrnbq", rune(rank[j-1])):
+			default:
+				return fmt.Errorf("invalid FEN '%s': bad character '%c' on rank %d", fen, c, 8-i)
+			}
+		}
+		if squares != 8 {
+			return fmt.Errorf("invalid FEN '%s': %d squares on rank %d instead of 8", fen, squares, 8-i)
+		}
+	}
+
+	if data[1] != "w" && data[1] != "b" {
+		return fmt.Errorf("invalid FEN '%s': side to move '%s' is not w or b", fen, data[1])
+	}
+	if data[2] != "-" && strings.Trim(data[2], "KQkqABCDEFGHabcdefgh") != "" {
+		return fmt.Errorf("invalid FEN '%s': bad castling '%s'", fen, data[2])
+	}
+	if data[3] != "-" && (len(data[3]) != 2 || data[3][0] < 'a' || data[3][0] > 'h' || (data[3][1] != '3' && data[3][1] != '6')) {
+		return fmt.Errorf("invalid FEN '%s': bad en passant target '%s'", fen, data[3])
+	}
+	for _, counter := range data[4:] {
+		if n, err := strconv.Atoi(counter); err != nil || n < 0 {
+			return fmt.Errorf("invalid FEN '%s': bad move counter '%s'", fen, counter)
+		}
+	}
+
+	//Position
+	chess.FEN(fen)
+	var (
+		whiteKings = bits.OnesCount64(chess.Boards[WHITE_KING])
+		blackKings = bits.OnesCount64(chess.Boards[BLACK_KING])
+	)
+	switch {
+	case variant == HORDE && (whiteKings != 0 || blackKings != 1):
+		return fmt.Errorf("invalid FEN '%s': the Horde has no King and Black has one", fen)
+	case variant == ATOMIC && (whiteKings > 1 || blackKings > 1):
+		return fmt.Errorf("invalid FEN '%s': more than one King for a side", fen)
+	case variant != HORDE && variant != ATOMIC && (whiteKings != 1 || blackKings != 1):
+		return fmt.Errorf("invalid FEN '%s': each side must have one King", fen)
+	}
+
+	pawns := chess.Boards[WHITE_PAWN] | chess.Boards[BLACK_PAWN]
+	if variant == HORDE {
+		pawns = chess.Boards[WHITE_PAWN]&^RANK_MASK[0] | chess.Boards[BLACK_PAWN] // The Horde can have pawns on the first rank
+	}
+	if pawns&(RANK_MASK[0]|RANK_MASK[7]) != 0 {
+		return fmt.Errorf("invalid FEN '%s': pawn on the first or last rank", fen)
+	}
+
+	if (chess.SideToMove == WHITE && blackKings == 1 && chess.IsBlackKingChecked()) ||
+		(chess.SideToMove == BLACK && whiteKings == 1 && chess.IsWhiteKingChecked()) {
+		return fmt.Errorf("invalid FEN '%s': the side not to move is in check", fen)
+	}
+	return nil
+}
+
+// Add a castling privilege from the FEN castling field (KQkq or a Rook file)
+func (chess *Chess) setCastlingPrivilege(cs rune) {
+	var (
+		king, rook = WHITE_KING, WHITE_ROOK
+		rank       = 0
+		file       = -1 // File of the Rook from a to h, -1 for the outermost Rook
+		kingSide   bool
+	)
+	switch {
+	case cs == 'K' || cs == 'Q':
+		kingSide = cs == 'K'
+	case cs == 'k' || cs == 'q':
+		king, rook, rank = BLACK_KING, BLACK_ROOK, 7
+		kingSide = cs == 'k'
+	case 'A' <= cs && cs <= 'H':
+		file = int(cs - 'A')
+	case 'a' <= cs && cs <= 'h':
+		king, rook, rank = BLACK_KING, BLACK_ROOK, 7
+		file = int(cs - 'a')
+	default:
+		return
+	}
+
+	//The King must be on its first rank
+	kingIndex := bits.TrailingZeros64(chess.Boards[king])
+	if kingIndex/8 != rank {
+		return
 	}
+	kingFile := 7 - kingIndex%8
+
+	//Find the outermost Rook of the side, or check the side of the given Rook
+	if file == -1 {
+		for f := range 8 {
+			if IsPieceAtIndex(chess.Boards[rook], 8*rank+7-f) && (f > kingFile) == kingSide && f != kingFile {
+				if file == -1 || kingSide {
+					file = f
+				}
+			}
+		}
+		if file == -1 {
+			return
+		}
+	} else {
+		kingSide = file > kingFile
+	}
+
+	privilege := WHITE_QUEEN_SIDE
+	switch {
+	case kingSide && rank == 0:
+		privilege = WHITE_KING_SIDE
+	case kingSide:
+		privilege = BLACK_KING_SIDE
+	case rank == 7:
+		privilege = BLACK_QUEEN_SIDE
+	}
+	chess.CastlingPrivilege |= privilege
+	chess.CastlingRooks[castlingIndex(privilege)] = 8*rank + 7 - file
+}
+
+// Export the position as a FEN string. The Crazyhouse pocket and promoted pieces, the checks of Three-check (remaining
+// checks, after the en passant target) and the Chess960 castling Rooks (X-FEN) are included, so FEN can read it back
+func (chess *Chess) ToFEN() string {
+	var (
+		fen   strings.Builder
+		board = chess.ToArray()
+	)
+
+	//Pieces from a8 to h1, the empty squares of a rank are counted
+	for rank := range 8 {
+		empty := 0
+		for file := range 8 {
+			square := 8*rank + file
+			if board[square] == " " {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				fen.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			fen.WriteString(board[square])
+			if IsPieceAtIndex(chess.Promoted, 63-square) {
+				fen.WriteByte('~')
+			}
+		}
+		if empty > 0 {
+			fen.WriteString(strconv.Itoa(empty))
+		}
+		if rank < 7 {
+			fen.WriteByte('/')
+		}
+	}
+	if chess.Variant == CRAZYHOUSE {
+		fen.WriteString("[" + chess.Pocket() + "]")
+	}
+
+	if chess.SideToMove == WHITE {
+		fen.WriteString(" w ")
+	} else {
+		fen.WriteString(" b ")
+	}
+
+	castling := ""
+	for _, cs := range []int{WHITE_KING_SIDE, WHITE_QUEEN_SIDE, BLACK_KING_SIDE, BLACK_QUEEN_SIDE} {
+		if chess.CastlingPrivilege&cs != 0 {
+			castling += chess.castlingLetter(cs)
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	fen.WriteString(castling)
+
+	if chess.EnPassantTarget == -1 {
+		fen.WriteString(" -")
+	} else {
+		fen.WriteString(" " + FromIndexToAlgebraic(chess.EnPassantTarget))
+	}
+	if chess.Variant == THREE_CHECK {
+		fen.WriteString(fmt.Sprintf(" %d+%d", THREE_CHECK_WIN-chess.Checks[0], THREE_CHECK_WIN-chess.Checks[1]))
+	}
+
+	fen.WriteString(fmt.Sprintf(" %d %d", chess.Halfmove, chess.Fullmove))
+	return fen.String()
+}
+
+// Letter of a castling privilege in the FEN: KQkq for the outermost Rook, otherwise the file of the Rook (X-FEN)
+func (chess *Chess) castlingLetter(cs int) string {
+	var (
+		rook   = chess.CastlingRooks[castlingIndex(cs)]
+		rooks  = chess.Boards[WHITE_ROOK]
+		letter = map[int]string{WHITE_KING_SIDE: "K", WHITE_QUEEN_SIDE: "Q", BLACK_KING_SIDE: "k", BLACK_QUEEN_SIDE: "q"}[cs]
+		file   = string(rune('A' + 7 - rook%8))
+		outer  uint64
+	)
+	if cs == BLACK_KING_SIDE || cs == BLACK_QUEEN_SIDE {
+		rooks = chess.Boards[BLACK_ROOK]
+		file = strings.ToLower(file)
+	}
+
+	//The squares of the rank beyond the Rook (toward the h-file on the King side)
+	if cs == WHITE_KING_SIDE || cs == BLACK_KING_SIDE {
+		outer = squaresBetween(rook-rook%8, rook) &^ (1 << rook)
+	} else {
+		outer = squaresBetween(rook, rook-rook%8+7) &^ (1 << rook)
+	}
+	if rooks&outer != 0 {
+		return file
+	}
+	return letter
 }
 
 func (chess *Chess) Clone() *Chess {
@@ -136,10 +426,23 @@ func (chess *Chess) Clone() *Chess {
 		clone.Boards[i] = chess.Boards[i]
 	}
 	clone.CastlingPrivilege = chess.CastlingPrivilege
+	clone.CastlingRooks = chess.CastlingRooks
 	clone.EnPassantTarget = chess.EnPassantTarget
 	clone.Fullmove = chess.Fullmove
 	clone.Halfmove = chess.Halfmove
 	clone.SideToMove = chess.SideToMove
+	clone.history = chess.history //History nodes are never modified, so it's safe to share
+	clone.hash, clone.mirror = chess.hash, chess.mirror
+	clone.Params = chess.Params
+	clone.network = chess.network
+	clone.Tablebase = chess.Tablebase
+	clone.Variant = chess.Variant
+	clone.Checks = chess.Checks
+	clone.Pockets = chess.Pockets
+	clone.Promoted = chess.Promoted
+	if chess.accumulator != nil {
+		clone.accumulator = chess.accumulator.clone()
+	}
 
 	return clone
 }
@@ -149,10 +452,24 @@ func (chess *Chess) Copy(c *Chess) {
 		chess.Boards[i] = c.Boards[i]
 	}
 	chess.CastlingPrivilege = c.CastlingPrivilege
+	chess.CastlingRooks = c.CastlingRooks
 	chess.EnPassantTarget = c.EnPassantTarget
 	chess.Fullmove = c.Fullmove
 	chess.Halfmove = c.Halfmove
 	chess.SideToMove = c.SideToMove
+	chess.history = c.history
+	chess.hash, chess.mirror = c.hash, c.mirror
+	chess.Params = c.Params
+	chess.network = c.network
+	chess.Tablebase = c.Tablebase
+	chess.Variant = c.Variant
+	chess.Checks = c.Checks
+	chess.Pockets = c.Pockets
+	chess.Promoted = c.Promoted
+	chess.accumulator = nil
+	if c.accumulator != nil {
+		chess.accumulator = c.accumulator.clone()
+	}
 }
 
 func (chess *Chess) Flip() {
@@ -174,6 +491,19 @@ func (chess *Chess) Flip() {
 
 	//Flip castling privilege
 	chess.CastlingPrivilege = ((chess.CastlingPrivilege >> 2) | (chess.CastlingPrivilege << 2)) & 15
+	rooks := chess.CastlingRooks
+	for i := range 4 {
+		chess.CastlingRooks[i] = FlipIndexVertical(rooks[(i+2)%4])
+	}
+	chess.Checks[0], chess.Checks[1] = chess.Checks[1], chess.Checks[0]
+	chess.Pockets[0], chess.Pockets[1] = chess.Pockets[1], chess.Pockets[0]
+	chess.Promoted = FlipVertical(chess.Promoted)
+
+	//The flipped position's hash and accumulators are already known
+	chess.hash, chess.mirror = chess.mirror, chess.hash
+	if chess.accumulator != nil {
+		chess.accumulator.values[0], chess.accumulator.values[1] = chess.accumulator.values[1], chess.accumulator.values[0]
+	}
 }
 
 func (chess *Chess) ToArray() [64]string {
@@ -215,6 +545,9 @@ func (chess *Chess) String() string {
 
 	boardStr += fmt.Sprintf("\nSide to move: %d\nEn passant target: %s\nCastling: %d\n",
 		chess.SideToMove, FromIndexToAlgebraic(chess.EnPassantTarget), chess.CastlingPrivilege)
+	if chess.Variant == CRAZYHOUSE {
+		boardStr += fmt.Sprintf("Pocket: [%s]\n", chess.Pocket())
+	}
 
 	return boardStr
 }
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+const CHESS960_POSITIONS = 960
+const CHESS960_STANDARD = 518 // Index of the standard starting position (RNBQKBNR)
+
+// Placement of the two Knights on the 5 empty squares left by the Bishops and the Queen
+var chess960_knights = [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}
+
+// Get the FEN of a Chess960 starting position from its index (0 to 959) in the Scharnagl numbering
+func Chess960FEN(index int) (string, error) {
+	if index < 0 || index >= CHESS960_POSITIONS {
+		return "", fmt.Errorf("invalid Chess960 position %d, must be between 0 and %d", index, CHESS960_POSITIONS-1)
+	}
+
+	//Files from a to h
+	var rank [8]byte
+	n := index
+	rank[2*(n%4)+1] = 'B' // Light squared Bishop
+	n /= 4
+	rank[2*(n%4)] = 'B' // Dark squared Bishop
+	n /= 4
+
+	//Place a piece on the i-th empty square
+	place := func(i int, piece byte) {
+		for file := range rank {
+			if rank[file] != 0 {
+				continue
+			}
+			if i == 0 {
+				rank[file] = piece
+				return
+			}
+			i--
+		}
+	}
+	place(n%6, 'Q')
+	n /= 6
+
+	//Place the second Knight first so that the index of the first one is not shifted
+	knights := chess960_knights[n]
+	place(knights[1], 'N')
+	place(knights[0], 'N')
+
+	//The King is always between the two Rooks
+	place(0, 'R')
+	place(0, 'K')
+	place(0, 'R')
+
+	white := string(rank[:])
+	return fmt.Sprintf("%s/pppppppp/8/8/8/8/PPPPPPPP/%s w KQkq - 0 1", strings.ToLower(white), white), nil
+}
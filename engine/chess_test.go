@@ -0,0 +1,77 @@
+package engine
+
+import "testing"
+
+func TestValidateFEN(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		fen     string
+		valid   bool
+	}{
+		{STANDARD, "", true},
+		{STANDARD, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", true},
+		{STANDARD, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq -", true},
+		{STANDARD, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0", true},
+		{THREE_CHECK, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1", true},
+		{HORDE, HORDE.StartFEN(), true},
+		{CRAZYHOUSE, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[Qn] w KQkq - 0 1", true},
+		{CRAZYHOUSE, "rnbqkbQ~r/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1/n w KQkq - 0 1", true},
+		{ATOMIC, "8/8/8/8/8/8/2k5/rR4KR w KQ - 0 1", true},
+		{ATOMIC, "8/8/8/8/8/8/2k5/rR5R w - - 0 1", true},
+
+		{STANDARD, "8/8/8", false},
+		{STANDARD, "8/8/8/8/8/8/8/8", false},
+		{STANDARD, "8/8/8/8/8/8/8/8 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K3/8 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K2 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K4 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4X3 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K3 x - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K3 w XY - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K3 w - e9 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K3 w - - x 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4KK2 w - - 0 1", false},
+		{STANDARD, "P3k3/8/8/8/8/8/8/4K3 w - - 0 1", false},
+		{STANDARD, "4k3/8/8/8/8/8/8/4K2R b - - 0 1", true},
+		{STANDARD, "4k3/8/8/8/8/8/8/4R1K1 w - - 0 1", false},
+		{STANDARD, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[Qn] w KQkq - 0 1", false},
+		{HORDE, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", false},
+		{ATOMIC, "kk6/8/8/8/8/8/8/K7 w - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		if err := ValidateFEN(test.variant, test.fen); (err == nil) != test.valid {
+			t.Errorf("ValidateFEN(%s, %q) = %v, want valid %v", test.variant, test.fen, err, test.valid)
+		}
+	}
+}
+
+// The full move counter is increased after each move of Black: normal move, castling and Crazyhouse drop
+func TestMakeMoveFullmove(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		fen     string
+		moves   []string
+		want    []int // Full move after each move
+	}{
+		{STANDARD, "", []string{"e2e4", "e7e5", "g1f3", "b8c6"}, []int{1, 2, 2, 3}},
+		{STANDARD, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 7", []string{"e1g1", "e8c8", "a1b1"}, []int{7, 8, 8}},
+		{CRAZYHOUSE, "4k3/8/8/8/8/8/8/4K3[Nn] w - - 0 3", []string{"N@c3", "n@c6"}, []int{3, 4}},
+	}
+
+	for _, test := range tests {
+		chess := NewChess()
+		chess.Variant = test.variant
+		chess.FEN(test.fen)
+		for i, str := range test.moves {
+			move, err := chess.ParseUCIMove(str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chess.MakeMove(move)
+			if chess.Fullmove != test.want[i] {
+				t.Errorf("%s after %s: Fullmove = %d, want %d", test.fen, str, chess.Fullmove, test.want[i])
+			}
+		}
+	}
+}
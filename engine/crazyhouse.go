@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"math/bits"
+	"strings"
+)
+
+/*
+ * Crazyhouse: a captured piece goes into the pocket of the side that captured it, and instead of moving a piece,
+ * a side can drop a piece of its pocket on any empty square (pawns not on the first and last ranks). A promoted
+ * piece goes back to the pocket as a pawn, so the promoted pieces are tracked on the board (Chess.Promoted).
+ * In the FEN, the pocket follow the board between brackets (RNBQKBNR[Qn]) and a promoted piece is marked with '~'
+ */
+
+// Piece letters of the drops and of the pocket in the FEN, indexed by board mod 6
+var pocket_letter = [5]string{"P", "R", "N", "B", "Q"}
+
+// Generate the drops of White on the target squares: every empty square, or the squares that block a single check
+func (chess *Chess) DropMoves(targets uint64) []Move {
+	var moves []Move
+
+	for piece := WHITE_PAWN; piece <= WHITE_QUEEN; piece++ {
+		if chess.Pockets[0][piece] == 0 {
+			continue
+		}
+
+		squares := targets
+		if piece == WHITE_PAWN {
+			squares &^= RANK_MASK[0] | RANK_MASK[7]
+		}
+		for squares != 0 {
+			index := bits.TrailingZeros64(squares)
+			moves = append(moves, Move{Drop: true, FromBoard: piece, FromIndex: index, ToBoard: piece, ToIndex: index})
+			ClearBit(index, &squares)
+		}
+	}
+
+	return moves
+}
+
+// Squares between the King and a sliding attacker, where a piece can be put to block the check
+func blockingSquares(kingIndex, attackerIndex int) uint64 {
+	low, high := Min(kingIndex, attackerIndex), Max(kingIndex, attackerIndex)
+	switch {
+	case IsAtSameRank(kingIndex, attackerIndex):
+		return CalculateRayAttackLine(low, high, RANK)
+	case IsAtSameFile(kingIndex, attackerIndex):
+		return CalculateRayAttackLine(low, high, FILE)
+	case IsAtSameDiagonal(kingIndex, attackerIndex):
+		return CalculateRayAttackLine(low, high, DIAGONAL)
+	default:
+		return CalculateRayAttackLine(low, high, ANTI_DIAGONAL)
+	}
+}
+
+// Perform a drop: the piece leave the pocket of the side to move and is put on the board
+func (chess *Chess) Drop(move Move) {
+	side := 0
+	if chess.SideToMove == BLACK {
+		side = 1
+	}
+
+	piece := move.ToBoard % 6
+	chess.hashPocket(side, piece, chess.Pockets[side][piece])
+	chess.Pockets[side][piece]--
+	chess.hashPocket(side, piece, chess.Pockets[side][piece])
+	SetBit(move.ToIndex, &chess.Boards[move.ToBoard])
+	chess.updatePiece(move.ToBoard, move.ToIndex)
+
+	chess.hashEnPassant(chess.EnPassantTarget)
+	chess.EnPassantTarget = -1
+
+	//The pocket never get the piece back without a capture, so the positions before can't be repeated
+	chess.Halfmove = 0
+	chess.history = nil
+
+	if chess.SideToMove == BLACK {
+		chess.Fullmove++
+	}
+	chess.SideToMove = WHITE + BLACK - chess.SideToMove
+	chess.hashSideToMove()
+	chess.updateVariantState()
+}
+
+// Put the piece captured by the side to move in its pocket (a promoted piece become a pawn again),
+// and keep track of the promoted pieces after the move
+func (chess *Chess) updatePocket(move Move, captured, captureIndex int) {
+	if captured != -1 {
+		side := 0
+		if chess.SideToMove == BLACK {
+			side = 1
+		}
+
+		piece := captured % 6
+		if IsPieceAtIndex(chess.Promoted, captureIndex) {
+			piece = WHITE_PAWN
+			ClearBit(captureIndex, &chess.Promoted)
+		}
+		chess.hashPocket(side, piece, chess.Pockets[side][piece])
+		chess.Pockets[side][piece]++
+		chess.hashPocket(side, piece, chess.Pockets[side][piece])
+	}
+
+	if IsPieceAtIndex(chess.Promoted, move.FromIndex) {
+		ClearBit(move.FromIndex, &chess.Promoted)
+		SetBit(move.ToIndex, &chess.Promoted)
+	} else if move.FromBoard != move.ToBoard {
+		SetBit(move.ToIndex, &chess.Promoted)
+	}
+}
+
+// Parse the pocket of the FEN (QRbn), the pieces of White in uppercase and the ones of Black in lowercase
+func (chess *Chess) parsePocket(pocket string) {
+	for _, c := range pocket {
+		index := strings.IndexRune("PRNBQprnbq", c)
+		if index == -1 {
+			continue // Kings can't be in the pocket, and '-' is an empty pocket
+		}
+		chess.Pockets[index/5][index%5]++
+	}
+}
+
+// Return the pocket in the FEN notation: the pieces of White in uppercase, then the ones of Black in lowercase
+func (chess *Chess) Pocket() string {
+	var str strings.Builder
+	for side := range 2 {
+		for _, piece := range []int{WHITE_QUEEN, WHITE_ROOK, WHITE_BISHOP, WHITE_KNIGHT, WHITE_PAWN} {
+			letter := pocket_letter[piece]
+			if side == 1 {
+				letter = strings.ToLower(letter)
+			}
+			str.WriteString(strings.Repeat(letter, chess.Pockets[side][piece]))
+		}
+	}
+	return str.String()
+}
@@ -86,3 +86,6 @@ const (
 	BLACK_QUEEN
 	BLACK_KING
 )
+
+// Light squares of the board (h1 is a light square)
+const LIGHT_SQUARES uint64 = 0xAA55AA55AA55AA55
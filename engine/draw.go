@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"math/bits"
+)
+
+// A position of the history and the one before it. Nodes are never modified once created: a move add one node in
+// front of the history, and the clones share the nodes of their parent
+type historyNode struct {
+	hash uint64
+	prev *historyNode
+}
+
+// Check if the current position already appeared at least count times (including this one) with the same side to move.
+// Only positions since the last irreversible move are kept in the history, since the others can't be repeated
+func (chess *Chess) IsRepetition(count int) bool {
+	var (
+		hash = chess.Hash()
+		seen = 1
+	)
+
+	//The first node of the history is the position before the last move (the opponent's turn), so we step by 2
+	for node := chess.history; node != nil && node.prev != nil; node = node.prev.prev {
+		if node.prev.hash == hash {
+			seen++
+			if seen >= count {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Check if 50 moves (100 plies) were played by both sides without pawn move or capture
+func (chess *Chess) IsFiftyMoveRule() bool {
+	return chess.Halfmove >= 100
+}
+
+// Check if neither side can possibly checkmate: K vs K, K and one minor piece vs K, or only bishops all on the same color
+func (chess *Chess) IsInsufficientMaterial() bool {
+	//A bare King can still win King of the Hill, a minor piece can still give checks, Horde is never
+	//drawn this way and the captured pieces of Crazyhouse come back
+	switch chess.Variant {
+	case KING_OF_THE_HILL, HORDE, CRAZYHOUSE:
+		return false
+	case THREE_CHECK:
+		return chess.GenerateAllWhites()|chess.GenerateAllBlacks() == chess.Boards[WHITE_KING]|chess.Boards[BLACK_KING]
+	case ATOMIC:
+		//A King can only be exploded by capturing a piece next to it: a single minor piece has nothing to capture
+		minors := chess.Boards[WHITE_KNIGHT] | chess.Boards[WHITE_BISHOP] | chess.Boards[BLACK_KNIGHT] | chess.Boards[BLACK_BISHOP]
+		all := chess.GenerateAllWhites() | chess.GenerateAllBlacks()
+		return all == chess.Boards[WHITE_KING]|chess.Boards[BLACK_KING]|minors && bits.OnesCount64(minors) <= 1
+	}
+
+	heavies := chess.Boards[WHITE_PAWN] | chess.Boards[WHITE_ROOK] | chess.Boards[WHITE_QUEEN] |
+		chess.Boards[BLACK_PAWN] | chess.Boards[BLACK_ROOK] | chess.Boards[BLACK_QUEEN]
+	if heavies != 0 {
+		return false
+	}
+
+	var (
+		knights = chess.Boards[WHITE_KNIGHT] | chess.Boards[BLACK_KNIGHT]
+		bishops = chess.Boards[WHITE_BISHOP] | chess.Boards[BLACK_BISHOP]
+	)
+	switch {
+	case bits.OnesCount64(knights|bishops) <= 1:
+		return true
+	case knights == 0:
+		return bishops&LIGHT_SQUARES == 0 || bishops&^LIGHT_SQUARES == 0
+	default:
+		return false
+	}
+}
+
+// Draw detection used inside the search. A twofold repetition is enough there: if a position repeat once,
+// the side that can repeat it can also repeat it again, so it's scored as a draw straight away
+func (chess *Chess) IsSearchDraw() bool {
+	return chess.IsFiftyMoveRule() || chess.IsInsufficientMaterial() || chess.IsRepetition(2)
+}
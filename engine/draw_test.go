@@ -0,0 +1,41 @@
+package engine
+
+import "testing"
+
+func TestIsRepetition(t *testing.T) {
+	chess := NewChess()
+	chess.FEN("")
+	clone := chess.Clone()
+
+	for i, str := range []string{"g1f3", "g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1", "f6g8"} {
+		chess.MakeMove(NewMove(chess, str))
+		if got, want := chess.IsRepetition(2), i >= 3; got != want {
+			t.Errorf("after %d moves: IsRepetition(2) = %v, want %v", i+1, got, want)
+		}
+		if got, want := chess.IsRepetition(3), i == 7; got != want {
+			t.Errorf("after %d moves: IsRepetition(3) = %v, want %v", i+1, got, want)
+		}
+	}
+
+	//The clone made before the moves share the history nodes, which are never modified
+	if clone.IsRepetition(2) {
+		t.Errorf("the clone history changed")
+	}
+
+	//A pawn move clear the history
+	chess.MakeMove(NewMove(chess, "e2e4"))
+	if chess.IsRepetition(2) || chess.history != nil {
+		t.Errorf("the history is kept after a pawn move")
+	}
+}
+
+func TestSearchMateBeforeDraw(t *testing.T) {
+	//Ra8 is the 100th ply without capture or pawn move, but it's checkmate
+	chess := NewChess()
+	chess.FEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 99 80")
+
+	score, move := chess.Search(3, -MATE, MATE)
+	if score != MATE-1 || move.UCI() != "a1a8" {
+		t.Errorf("Search() = %d %s, want %d a1a8", score, move.UCI(), MATE-1)
+	}
+}
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"math/bits"
+	"strings"
+)
+
+/*
+ * Endgame knowledge. Some endings are misplayed by the normal evaluation, because winning them need a plan that
+ * material and piece-square tables don't know (driving the King to the right corner in KBNK), or because they are
+ * drawn despite the material advantage (wrong-colored bishop). The position is recognized by its material signature
+ * (like "KBNvK", White pieces first) and then:
+ * - Known endings get a specialized evaluation that replace the normal one
+ * - Drawish endings keep the normal evaluation, but scaled down for the side that cannot win
+ * The specialized evaluations are written for the strong side being White, for Black we flip the board
+ */
+
+// Score of a won ending, so the search always prefer converting to a known win over keeping more material
+const KNOWN_WIN = 10000
+
+// Scale factor (out of SCALE_NORMAL) of the score of a side that cannot win
+const (
+	SCALE_NORMAL  = 16
+	SCALE_DRAWISH = 1
+)
+
+type endgame struct {
+	name     string
+	strong   int
+	evaluate func(chess *Chess) int // Score from the strong side perspective, with the strong side being White
+}
+
+// Known endings by material key, in both colors
+var endgames = map[uint64]endgame{}
+
+func init() {
+	registerEndgame("KBNvK", evaluateKBNK)
+	registerEndgame("KPvK", evaluateKPK)
+	registerEndgame("KRvKP", evaluateKRKP)
+	registerEndgame("KNNvK", evaluateDraw)
+}
+
+// Register an ending with the strong side as White, and the same ending with the colors swapped
+func registerEndgame(signature string, evaluate func(chess *Chess) int) {
+	white, black, _ := strings.Cut(signature, "v")
+	endgames[signatureKey(white, black)] = endgame{name: signature, strong: WHITE, evaluate: evaluate}
+	endgames[signatureKey(black, white)] = endgame{name: black + "v" + white, strong: BLACK, evaluate: evaluate}
+}
+
+func signatureKey(white, black string) uint64 {
+	var counts [12]int
+	for _, piece := range white {
+		counts[strings.IndexRune("PRNBQK", piece)]++
+	}
+	for _, piece := range black {
+		counts[6+strings.IndexRune("PRNBQK", piece)]++
+	}
+	return materialKey(counts)
+}
+
+// Material key: 4 bits for the number of each piece type (the Kings are always there, so they are not counted)
+func materialKey(counts [12]int) uint64 {
+	var key uint64
+	for piece, count := range counts {
+		if piece != WHITE_KING && piece != BLACK_KING {
+			key |= uint64(min(count, 15)) << (4 * piece)
+		}
+	}
+	return key
+}
+
+// Return the material signature of the position, White pieces first (like "KRvKP")
+func (chess *Chess) MaterialSignature() string {
+	var sb strings.Builder
+	for _, offset := range []int{0, 6} {
+		if offset == 6 {
+			sb.WriteString("v")
+		}
+		sb.WriteString("K")
+		for _, piece := range []int{WHITE_QUEEN, WHITE_ROOK, WHITE_BISHOP, WHITE_KNIGHT, WHITE_PAWN} {
+			sb.WriteString(strings.Repeat(string("PRNBQK"[piece]), bits.OnesCount64(chess.Boards[piece+offset])))
+		}
+	}
+	return sb.String()
+}
+
+// If the position is a known ending, return its specialized score (from White perspective) and the name of the ending
+func (chess *Chess) EvaluateEndgame() (int, string, bool) {
+	var (
+		whites = chess.GenerateAllWhites()
+		blacks = chess.GenerateAllBlacks()
+	)
+
+	//Only a few pieces left, or a bare King
+	if bits.OnesCount64(whites|blacks) > 5 && bits.OnesCount64(whites) > 1 && bits.OnesCount64(blacks) > 1 {
+		return 0, "", false
+	}
+
+	var counts [12]int
+	for piece := range counts {
+		counts[piece] = bits.OnesCount64(chess.Boards[piece])
+	}
+
+	//Specific endings
+	if ending, ok := endgames[materialKey(counts)]; ok {
+		return chess.strongScore(ending.strong, ending.evaluate), ending.name, true
+	}
+
+	//No pawn and at most one minor piece each: nobody can win
+	if counts[WHITE_PAWN]+counts[BLACK_PAWN]+counts[WHITE_ROOK]+counts[BLACK_ROOK]+counts[WHITE_QUEEN]+counts[BLACK_QUEEN] == 0 &&
+		counts[WHITE_KNIGHT]+counts[WHITE_BISHOP] <= 1 && counts[BLACK_KNIGHT]+counts[BLACK_BISHOP] <= 1 {
+		return 0, chess.MaterialSignature(), true
+	}
+
+	//Bare King against enough material to force mate
+	for _, strong := range []int{WHITE, BLACK} {
+		own, weak := whites, blacks
+		if strong == BLACK {
+			own, weak = blacks, whites
+		}
+		if bits.OnesCount64(weak) == 1 && bits.OnesCount64(own) > 1 && chess.canForceMate(strong) {
+			return chess.strongScore(strong, evaluateKXK), "KXK", true
+		}
+	}
+
+	return 0, "", false
+}
+
+// Scale down the normal score (from White perspective) when the side that is ahead cannot win
+func (chess *Chess) ScaleEndgame(score int) int {
+	strong := WHITE
+	if score < 0 {
+		strong = BLACK
+	}
+	offset := 0
+	if strong == BLACK {
+		offset = 6
+	}
+
+	//Only one minor piece and no pawn: there is not enough material to mate
+	if chess.Boards[WHITE_PAWN+offset]|chess.Boards[WHITE_ROOK+offset]|chess.Boards[WHITE_QUEEN+offset] == 0 &&
+		bits.OnesCount64(chess.Boards[WHITE_KNIGHT+offset]|chess.Boards[WHITE_BISHOP+offset]) <= 1 {
+		return score * SCALE_DRAWISH / SCALE_NORMAL
+	}
+
+	if chess.isWrongBishop(strong) {
+		return 0
+	}
+
+	return score
+}
+
+// Check if the side has the material to force mate against a bare King
+func (chess *Chess) canForceMate(side int) bool {
+	offset := 0
+	if side == BLACK {
+		offset = 6
+	}
+
+	if chess.Boards[WHITE_QUEEN+offset]|chess.Boards[WHITE_ROOK+offset] != 0 {
+		return true
+	}
+	bishops := chess.Boards[WHITE_BISHOP+offset]
+	return (bishops != 0 && chess.Boards[WHITE_KNIGHT+offset] != 0) ||
+		(bishops&LIGHT_SQUARES != 0 && bishops&^LIGHT_SQUARES != 0)
+}
+
+// Check for King, bishop and rook pawns against a bare King, where the bishop doesn't control the promotion square
+// and the defending King reached the corner: this is a draw
+func (chess *Chess) isWrongBishop(strong int) bool {
+	c := chess
+	if strong == BLACK {
+		c = chess.Clone()
+		c.Flip()
+	}
+
+	pawns, bishop := c.Boards[WHITE_PAWN], c.Boards[WHITE_BISHOP]
+	if pawns == 0 || bits.OnesCount64(bishop) != 1 ||
+		c.Boards[WHITE_KNIGHT]|c.Boards[WHITE_ROOK]|c.Boards[WHITE_QUEEN] != 0 || bits.OnesCount64(c.GenerateAllBlacks()) != 1 {
+		return false
+	}
+
+	//All the pawns on the same rook file
+	var promotion int
+	switch {
+	case pawns&^FILE_MASK[0] == 0:
+		promotion = FromAlgebraicToIndex("a8")
+	case pawns&^FILE_MASK[7] == 0:
+		promotion = FromAlgebraicToIndex("h8")
+	default:
+		return false
+	}
+
+	bishopOnLight := bishop&LIGHT_SQUARES != 0
+	promotionOnLight := IsPieceAtIndex(LIGHT_SQUARES, promotion)
+	weakKing := bits.TrailingZeros64(c.Boards[BLACK_KING])
+
+	return bishopOnLight != promotionOnLight && Distance(weakKing, promotion) <= 1
+}
+
+// Evaluate an ending with the strong side as White (flipping the board if needed), return the score from White perspective
+func (chess *Chess) strongScore(strong int, evaluate func(chess *Chess) int) int {
+	if strong == WHITE {
+		return evaluate(chess)
+	}
+
+	flipped := chess.Clone()
+	flipped.Flip()
+	return -evaluate(flipped)
+}
+
+// Bonus for a square close to the edge of the board
+func pushToEdge(index int) int {
+	return 20 * (3 - min(index%8, 7-index%8, index/8, 7-index/8))
+}
+
+// Bonus for two pieces (usually the Kings) being close to each other
+func pushClose(index1, index2 int) int {
+	return 140 - 20*Distance(index1, index2)
+}
+
+// White material value in the endgame (the King excluded)
+func (chess *Chess) whiteMaterial() int {
+	var (
+		params   = chess.EvalParams()
+		material = 0
+	)
+	for piece := WHITE_PAWN; piece < WHITE_KING; piece++ {
+		material += bits.OnesCount64(chess.Boards[piece]) * params.MaterialEG[piece]
+	}
+	return material
+}
+
+func evaluateDraw(chess *Chess) int {
+	return 0
+}
+
+// Mating material against a bare King: drive the King to the edge and bring the strong King close
+func evaluateKXK(chess *Chess) int {
+	var (
+		strongKing = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		weakKing   = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+	)
+	return KNOWN_WIN + chess.whiteMaterial() + pushToEdge(weakKing) + pushClose(strongKing, weakKing)
+}
+
+// King, bishop and knight against King: the mate is only possible in a corner of the bishop color
+func evaluateKBNK(chess *Chess) int {
+	var (
+		strongKing = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		weakKing   = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+		corners    = [2]int{FromAlgebraicToIndex("a1"), FromAlgebraicToIndex("h8")} // Dark corners
+	)
+	if chess.Boards[WHITE_BISHOP]&LIGHT_SQUARES != 0 {
+		corners = [2]int{FromAlgebraicToIndex("h1"), FromAlgebraicToIndex("a8")}
+	}
+
+	corner := min(Distance(weakKing, corners[0]), Distance(weakKing, corners[1]))
+	return KNOWN_WIN + chess.whiteMaterial() + 30*(7-corner) + pushClose(strongKing, weakKing)
+}
+
+// King and pawn against King: the result is known from the bitbase, a win is better with the pawn closer to promotion
+func evaluateKPK(chess *Chess) int {
+	var (
+		strongKing = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		weakKing   = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+		pawn       = bits.TrailingZeros64(chess.Boards[WHITE_PAWN])
+	)
+	if !ProbeKPK(chess.SideToMove == WHITE, strongKing, pawn, weakKing) {
+		return 0
+	}
+	return KNOWN_WIN + chess.whiteMaterial() + 20*(pawn/8)
+}
+
+// King and rook against King and pawn. Adapted from Stockfish: the rook wins if the strong King is in front of the pawn,
+// or if the weak King is too far from the pawn. Otherwise, the score depend on the race between the Kings and the pawn
+func evaluateKRKP(chess *Chess) int {
+	var (
+		params     = chess.EvalParams()
+		strongKing = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		weakKing   = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+		rook       = bits.TrailingZeros64(chess.Boards[WHITE_ROOK])
+		pawn       = bits.TrailingZeros64(chess.Boards[BLACK_PAWN])
+		promotion  = pawn % 8 // Black pawn promote on the 1st rank
+		strongMove = 0
+		weakMove   = 0
+		score      int
+	)
+	if chess.SideToMove == WHITE {
+		strongMove = 1
+	} else {
+		weakMove = 1
+	}
+
+	switch {
+	case IsAtSameFile(strongKing, pawn) && strongKing < pawn:
+		//The strong King is in front of the pawn
+		score = params.MaterialEG[WHITE_ROOK] - Distance(strongKing, pawn)
+	case Distance(weakKing, pawn) >= 3+weakMove && Distance(weakKing, rook) >= 3:
+		//The weak King is too far from the pawn to protect it
+		score = params.MaterialEG[WHITE_ROOK] - Distance(strongKing, pawn)
+	case weakKing/8 <= 2 && Distance(weakKing, pawn) == 1 && strongKing/8 >= 3 && Distance(strongKing, pawn) > 2+strongMove:
+		//The pawn is supported by its King and far advanced, the strong King is too far: it's drawish
+		score = 80 - 8*Distance(strongKing, pawn)
+	default:
+		score = 200 - 8*(Distance(strongKing, pawn-8)-Distance(weakKing, pawn-8)-Distance(pawn, promotion))
+	}
+
+	return score
+}
@@ -1,89 +1,16 @@
 package engine
 
 import (
+	"fmt"
 	"math/bits"
+	"strings"
 )
 
-var (
-	//Material value of each piece type (centipawn)
-	material = map[int]int{
-		WHITE_PAWN:   100,
-		WHITE_ROOK:   500,
-		WHITE_KNIGHT: 320,
-		WHITE_BISHOP: 330,
-		WHITE_QUEEN:  900,
-		WHITE_KING:   20000,
-	}
-
-	//Piece-square value (https://www.chessprogramming.org/Simplified_Evaluation_Function)
-	piece_square_table = map[int][]int{
-		WHITE_PAWN: {
-			0, 0, 0, 0, 0, 0, 0, 0,
-			50, 50, 50, 50, 50, 50, 50, 50,
-			10, 10, 20, 30, 30, 20, 10, 10,
-			5, 5, 10, 25, 25, 10, 5, 5,
-			0, 0, 0, 20, 20, 0, 0, 0,
-			5, -5, -10, 0, 0, -10, -5, 5,
-			5, 10, 10, -20, -20, 10, 10, 5,
-			0, 0, 0, 0, 0, 0, 0, 0,
-		},
-
-		WHITE_ROOK: {
-			0, 0, 0, 0, 0, 0, 0, 0,
-			5, 10, 10, 10, 10, 10, 10, 5,
-			-5, 0, 0, 0, 0, 0, 0, -5,
-			-5, 0, 0, 0, 0, 0, 0, -5,
-			-5, 0, 0, 0, 0, 0, 0, -5,
-			-5, 0, 0, 0, 0, 0, 0, -5,
-			-5, 0, 0, 0, 0, 0, 0, -5,
-			0, 0, 0, 5, 5, 0, 0, 0,
-		},
-
-		WHITE_KNIGHT: {
-			-50, -40, -30, -30, -30, -30, -40, -50,
-			-40, -20, 0, 0, 0, 0, -20, -40,
-			-30, 0, 10, 15, 15, 10, 0, -30,
-			-30, 5, 15, 20, 20, 15, 5, -30,
-			-30, 0, 15, 20, 20, 15, 0, -30,
-			-30, 5, 10, 15, 15, 10, 5, -30,
-			-40, -20, 0, 5, 5, 0, -20, -40,
-			-50, -40, -30, -30, -30, -30, -40, -50,
-		},
-
-		WHITE_BISHOP: {
-			-20, -10, -10, -10, -10, -10, -10, -20,
-			-10, 0, 0, 0, 0, 0, 0, -10,
-			-10, 0, 5, 10, 10, 5, 0, -10,
-			-10, 5, 5, 10, 10, 5, 5, -10,
-			-10, 0, 10, 10, 10, 10, 0, -10,
-			-10, 10, 10, 10, 10, 10, 10, -10,
-			-10, 5, 0, 0, 0, 0, 5, -10,
-			-20, -10, -10, -10, -10, -10, -10, -20,
-		},
-
-		WHITE_QUEEN: {
-			-20, -10, -10, -5, -5, -10, -10, -20,
-			-10, 0, 0, 0, 0, 0, 0, -10,
-			-10, 0, 5, 5, 5, 5, 0, -10,
-			-5, 0, 5, 5, 5, 5, 0, -5,
-			0, 0, 5, 5, 5, 5, 0, -5,
-			-10, 5, 5, 5, 5, 5, 0, -10,
-			-10, 0, 5, 0, 0, 0, 0, -10,
-			-20, -10, -10, -5, -5, -10, -10, -20,
-		},
-
-		WHITE_KING: {
-			-30, -40, -40, -50, -50, -40, -40, -30,
-			-30, -40, -40, -50, -50, -40, -40, -30,
-			-30, -40, -40, -50, -50, -40, -40, -30,
-			-30, -40, -40, -50, -50, -40, -40, -30,
-			-20, -30, -30, -40, -40, -30, -30, -20,
-			-10, -20, -20, -20, -20, -20, -20, -10,
-			20, 20, 0, 0, 0, 0, 20, 20,
-			20, 30, 10, 0, 0, 10, 30, 20,
-		},
-	}
-)
+// Game phase at the start of the game (see EvalParams.PhaseWeight)
+const TOTAL_PHASE = 24
+
+// Name of the piece-square terms in the evaluation trace
+var piece_square_names = [6]string{"pst pawn", "pst rook", "pst knight", "pst bishop", "pst queen", "pst king"}
 
 func EvaluatePS(bitboard uint64, piece_square []int, side int) int {
 	var (
@@ -107,57 +34,230 @@ func (chess *Chess) CalculateBonus() int {
 	/*
 	 * Refer to the rule state in chessprograming wiki: https://www.chessprogramming.org/Material
 	 * All the bonus/penalty point can be tune further
-	 * This is based on White perspective, for Black we'll flip the board and reuse White logic
+	 * Like Evaluate, this is based on White perspective: White's bonus minus Black's bonus
 	 */
-	if chess.SideToMove == BLACK {
-		chess.Flip()
-		defer chess.Flip()
-	}
+	e := evaluation{params: chess.EvalParams()}
+	chess.evaluateBonus(&e, WHITE)
+	chess.evaluateBonus(&e, BLACK)
+	return e.bonus
+}
 
-	var bonus = 0
+// Bonus of one side
+func (chess *Chess) evaluateBonus(e *evaluation, side int) {
+	offset := 0
+	if side == BLACK {
+		offset = 6
+	}
 
 	//Bonus for pair bishop
-	if bits.OnesCount64(chess.Boards[WHITE_BISHOP]) >= 2 {
-		bonus += 66
+	if bits.OnesCount64(chess.Boards[WHITE_BISHOP+offset]) >= 2 {
+		e.addBonus("bishop pair", side, e.params.BishopPair)
 	}
 
 	//Penalty for knight pair
-	if bits.OnesCount64(chess.Boards[WHITE_KNIGHT]) >= 2 {
-		bonus -= 64
+	if bits.OnesCount64(chess.Boards[WHITE_KNIGHT+offset]) >= 2 {
+		e.addBonus("knight pair", side, e.params.KnightPair)
 	}
 
 	//Penalty for rook pair
-	if bits.OnesCount64(chess.Boards[WHITE_ROOK]) >= 2 {
-		bonus -= 100
+	if bits.OnesCount64(chess.Boards[WHITE_ROOK+offset]) >= 2 {
+		e.addBonus("rook pair", side, e.params.RookPair)
 	}
 
 	//Bonus for pair queen (encourage promotion to queen)
-	if bits.OnesCount64(chess.Boards[WHITE_QUEEN]) >= 2 {
-		bonus -= 180
+	if bits.OnesCount64(chess.Boards[WHITE_QUEEN+offset]) >= 2 {
+		e.addBonus("queen pair", side, e.params.QueenPair)
 	}
 
 	//Penalty for not having any pawn left (harder for checkmate in endgame)
-	if bits.OnesCount64(chess.Boards[WHITE_PAWN]) == 0 {
-		bonus -= 300
+	if bits.OnesCount64(chess.Boards[WHITE_PAWN+offset]) == 0 {
+		e.addBonus("no pawn", side, e.params.NoPawn)
+	}
+}
+
+// Game phase from the remaining material: TOTAL_PHASE at the start of the game, 0 when only kings and pawns are left
+func (chess *Chess) Phase() int {
+	var (
+		params = chess.EvalParams()
+		phase  = 0
+	)
+	for i := WHITE_PAWN; i <= WHITE_KING; i++ {
+		phase += (bits.OnesCount64(chess.Boards[i]) + bits.OnesCount64(chess.Boards[i+6])) * params.PhaseWeight[i]
 	}
 
-	return bonus
+	//Promotion can push the phase over the starting value
+	return min(phase, TOTAL_PHASE)
 }
 
+// Evaluate the position from White perspective, with the NNUE network if the position has one.
+// Known endings are evaluated by their specialized evaluation instead (see endgame.go)
 func (chess *Chess) Evaluate() int {
-	//Calculate material value
-	mat := 0
+	if chess.Variant != STANDARD {
+		return chess.evaluate(nil) // The endgame knowledge and the network are for standard chess only
+	}
+	if score, _, ok := chess.EvaluateEndgame(); ok {
+		return score
+	}
+	if chess.network != nil {
+		return chess.ScaleEndgame(chess.EvaluateNNUE())
+	}
+	return chess.ScaleEndgame(chess.evaluate(nil))
+}
 
-	for i := WHITE_PAWN; i <= WHITE_KING; i++ {
-		mat += (bits.OnesCount64(chess.Boards[i]) - bits.OnesCount64(chess.Boards[i+6])) * material[i]
+// Evaluate the position and return the breakdown of the evaluation by term, for each side
+func (chess *Chess) EvaluateTrace() EvalTrace {
+	trace := EvalTrace{}
+	trace.Score = chess.evaluate(&trace)
+	if chess.Variant != STANDARD {
+		return trace
+	}
+	if score, name, ok := chess.EvaluateEndgame(); ok {
+		trace.Score, trace.Endgame = score, name
+	} else if scaled := chess.ScaleEndgame(trace.Score); scaled != trace.Score {
+		trace.Score, trace.Endgame = scaled, "scaled down (drawish)"
 	}
+	return trace
+}
 
-	//Calculate piece square table
-	ps := 0
-	for i := WHITE_PAWN; i <= WHITE_KING; i++ {
-		ps += EvaluatePS(chess.Boards[i], piece_square_table[i], WHITE)
-		ps -= EvaluatePS(chess.Boards[i+6], piece_square_table[i], BLACK)
+func (chess *Chess) evaluate(trace *EvalTrace) int {
+	e := evaluation{params: chess.EvalParams(), trace: trace}
+
+	//Calculate material value and piece square table, for both middlegame and endgame
+	for _, side := range []int{WHITE, BLACK} {
+		offset := 0
+		if side == BLACK {
+			offset = 6
+		}
+
+		for i := WHITE_PAWN; i <= WHITE_KING; i++ {
+			count := bits.OnesCount64(chess.Boards[i+offset])
+			e.add("material", side, count*e.params.MaterialMG[i], count*e.params.MaterialEG[i])
+			e.add(piece_square_names[i], side, EvaluatePS(chess.Boards[i+offset], e.params.PieceSquareMG[i][:], side),
+				EvaluatePS(chess.Boards[i+offset], e.params.PieceSquareEG[i][:], side))
+		}
+	}
+
+	//Pawn structure
+	chess.evaluatePawns(&e)
+
+	//Mobility and king safety
+	chess.evaluateActivity(&e)
+
+	//Variant specific terms
+	if chess.Variant != STANDARD {
+		chess.evaluateVariant(&e, WHITE)
+		chess.evaluateVariant(&e, BLACK)
+	}
+
+	//Interpolate between middlegame and endgame score by the game phase
+	phase := chess.Phase()
+	score := (e.mg*phase + e.eg*(TOTAL_PHASE-phase)) / TOTAL_PHASE
+
+	//Material bonus
+	chess.evaluateBonus(&e, WHITE)
+	chess.evaluateBonus(&e, BLACK)
+
+	if trace != nil {
+		trace.Phase, trace.MG, trace.EG, trace.Bonus = phase, e.mg, e.eg, e.bonus
+	}
+
+	return score + e.bonus
+}
+
+// Middlegame and endgame score of an evaluation term
+type TaperedScore struct {
+	MG, EG int
+}
+
+type EvalTerm struct {
+	Name         string
+	White, Black TaperedScore
+}
+
+// Breakdown of an evaluation. All the totals are from White perspective, the bonus is not tapered (MG = EG in its terms)
+type EvalTrace struct {
+	Terms   []EvalTerm
+	MG, EG  int // Tapered terms, before the interpolation
+	Bonus   int
+	Phase   int
+	Score   int
+	Endgame string // Known ending that replaced or scaled the score, if any
+}
+
+func (trace *EvalTrace) add(name string, side, mg, eg int) {
+	index := -1
+	for i := range trace.Terms {
+		if trace.Terms[i].Name == name {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		trace.Terms = append(trace.Terms, EvalTerm{Name: name})
+		index = len(trace.Terms) - 1
 	}
 
-	return mat + ps + chess.CalculateBonus()
+	term := &trace.Terms[index]
+	if side == WHITE {
+		term.White.MG += mg
+		term.White.EG += eg
+	} else {
+		term.Black.MG += mg
+		term.Black.EG += eg
+	}
+}
+
+func (trace *EvalTrace) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%-26s| %-14s| %-14s| %s\n", "Term", "White", "Black", "Total")
+	fmt.Fprintf(&sb, "%-26s| %6s %6s | %6s %6s | %6s %6s\n", "", "MG", "EG", "MG", "EG", "MG", "EG")
+	sb.WriteString(strings.Repeat("-", 26) + "+" + strings.Repeat("-", 15) + "+" + strings.Repeat("-", 15) + "+" + strings.Repeat("-", 15) + "\n")
+	for _, term := range trace.Terms {
+		fmt.Fprintf(&sb, "%-26s| %6d %6d | %6d %6d | %6d %6d\n", term.Name, term.White.MG, term.White.EG,
+			term.Black.MG, term.Black.EG, term.White.MG-term.Black.MG, term.White.EG-term.Black.EG)
+	}
+	sb.WriteString(strings.Repeat("-", 26) + "+" + strings.Repeat("-", 15) + "+" + strings.Repeat("-", 15) + "+" + strings.Repeat("-", 15) + "\n")
+	tapered := (trace.MG*trace.Phase + trace.EG*(TOTAL_PHASE-trace.Phase)) / TOTAL_PHASE
+	fmt.Fprintf(&sb, "Phase: %d/%d, tapered: %d, bonus: %d\n", trace.Phase, TOTAL_PHASE, tapered, trace.Bonus)
+	if trace.Endgame != "" {
+		fmt.Fprintf(&sb, "Endgame: %s\n", trace.Endgame)
+	}
+	fmt.Fprintf(&sb, "Score: %d (White perspective)", trace.Score)
+
+	return sb.String()
+}
+
+// Accumulator of the evaluation terms, from White perspective. If it has a trace, every term is also recorded in it
+type evaluation struct {
+	mg, eg int
+	bonus  int
+	params *EvalParams
+	trace  *EvalTrace
+}
+
+// Add a tapered term of one side
+func (e *evaluation) add(name string, side, mg, eg int) {
+	if side == WHITE {
+		e.mg += mg
+		e.eg += eg
+	} else {
+		e.mg -= mg
+		e.eg -= eg
+	}
+	if e.trace != nil {
+		e.trace.add(name, side, mg, eg)
+	}
+}
+
+// Add a bonus term of one side, which is added after the interpolation
+func (e *evaluation) addBonus(name string, side, bonus int) {
+	if side == WHITE {
+		e.bonus += bonus
+	} else {
+		e.bonus -= bonus
+	}
+	if e.trace != nil {
+		e.trace.add(name, side, bonus, bonus)
+	}
 }
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+ * A game: the moves played from a starting position, with their SAN and the position after each of them. The moves
+ * that are undone are kept after the current ply, so they can be redone, until another move is played
+ */
+
+// A move of the game, with the position after it
+type GameMove struct {
+	Move Move
+	SAN  string
+	FEN  string    // Position after the move
+	Time time.Time // When the move was played
+}
+
+type Game struct {
+	StartFEN string     // Starting position
+	Moves    []GameMove // Moves played to reach the current position, followed by the ones that were undone
+	Ply      int        // Number of moves played to reach the current position
+	chess    *Chess     // Current position
+}
+
+// Start a game of the variant from the FEN, empty for the starting position of the variant
+func NewGame(variant Variant, fen string) *Game {
+	chess := NewChess()
+	chess.Variant = variant
+	chess.FEN(fen)
+	return &Game{StartFEN: chess.ToFEN(), chess: chess}
+}
+
+// Current position of the game. It's changed by the game only: the moves are played with Play
+func (game *Game) Position() *Chess {
+	return game.chess
+}
+
+// Play a legal move in the current position. The moves that were undone can't be redone anymore
+func (game *Game) Play(move Move) {
+	san := game.chess.SAN(move)
+	game.chess.MakeMove(move)
+	game.Moves = append(game.Moves[:game.Ply], GameMove{Move: move, SAN: san, FEN: game.chess.ToFEN(), Time: time.Now()})
+	game.Ply++
+}
+
+// Take back the last move played. Return false at the start of the game
+func (game *Game) Undo() bool {
+	if game.Ply == 0 {
+		return false
+	}
+	game.GoTo(game.Ply - 1)
+	return true
+}
+
+// Play again the last move undone. Return false if there is none
+func (game *Game) Redo() bool {
+	if game.Ply == len(game.Moves) {
+		return false
+	}
+	game.chess.MakeMove(game.Moves[game.Ply].Move)
+	game.Ply++
+	return true
+}
+
+// Go to the position after the given number of moves (0 for the starting position), the moves after it can be
+// redone. The moves are replayed from the start, so the positions before are known for the repetitions
+func (game *Game) GoTo(ply int) error {
+	if ply < 0 || ply > len(game.Moves) {
+		return fmt.Errorf("ply %d is out of the game (0 to %d)", ply, len(game.Moves))
+	}
+
+	game.chess.FEN(game.StartFEN)
+	for _, move := range game.Moves[:ply] {
+		game.chess.MakeMove(move.Move)
+	}
+	game.Ply = ply
+	return nil
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"math/bits"
+	"sync"
+)
+
+/*
+ * KPK bitbase: the result (win or draw) of every King and pawn against King position, so the ending is played perfectly.
+ * The bitbase is built in memory by retrograde analysis the first time it is probed:
+ * - Every position is first classified from the rules: invalid (the Kings are touching, a piece on the same square,
+ *   the side not to move in check), won (the pawn promote safely), drawn (stalemate, or the pawn is captured)
+ * - Then the other positions are solved from their successors until nothing change: with White (the side with the pawn)
+ *   to move a position is won if one move lead to a won position, and drawn if all moves lead to drawn positions. With
+ *   Black to move it is the opposite. The positions still unknown at the end are draws (White cannot make progress)
+ * The pawn is always on the a to d files, a pawn on the other files is mirrored. Only the wins are kept, as a bitset
+ */
+
+const (
+	KPK_PAWN_SQUARES = 24 // 4 files x 6 ranks
+	KPK_SIZE         = 2 * 64 * 64 * KPK_PAWN_SQUARES
+)
+
+const (
+	KPK_UNKNOWN = iota
+	KPK_INVALID
+	KPK_DRAW
+	KPK_WIN
+)
+
+var (
+	kpk_bitbase [KPK_SIZE / 64]uint64
+	kpk_once    sync.Once
+)
+
+// Index of a position, with the pawn on the a to d files
+func kpkIndex(whiteToMove bool, whiteKing, pawn, blackKing int) int {
+	side := 0
+	if !whiteToMove {
+		side = 1
+	}
+	pawnSquare := (pawn/8-1)*4 + (7 - pawn%8)
+	return side | whiteKing<<1 | blackKing<<7 | pawnSquare<<13
+}
+
+// Position of an index (inverse of kpkIndex)
+func kpkPosition(index int) (bool, int, int, int) {
+	pawnSquare := index >> 13
+	pawn := (pawnSquare/4+1)*8 + 7 - pawnSquare%4
+	return index&1 == 0, (index >> 1) & 63, pawn, (index >> 7) & 63
+}
+
+// Probe the bitbase, with White having the pawn. Return true if White wins, false if it's a draw
+func ProbeKPK(whiteToMove bool, whiteKing, pawn, blackKing int) bool {
+	kpk_once.Do(generateKPK)
+
+	//Mirror the board so the pawn is on the a to d files
+	if pawn%8 < 4 {
+		whiteKing, pawn, blackKing = whiteKing^7, pawn^7, blackKing^7
+	}
+	index := kpkIndex(whiteToMove, whiteKing, pawn, blackKing)
+	return kpk_bitbase[index/64]&(1<<(index%64)) != 0
+}
+
+// If the position is King and pawn against King, return the winner (WHITE, BLACK, or 0 for a draw)
+func (chess *Chess) ProbeKPK() (int, bool) {
+	var (
+		whites = chess.GenerateAllWhites()
+		blacks = chess.GenerateAllBlacks()
+	)
+	if chess.Variant != STANDARD || bits.OnesCount64(whites|blacks) != 3 || chess.Boards[WHITE_PAWN]|chess.Boards[BLACK_PAWN] == 0 {
+		return 0, false
+	}
+
+	//The side with the pawn is seen as White
+	c, strong := chess, WHITE
+	if chess.Boards[BLACK_PAWN] != 0 {
+		c, strong = chess.Clone(), BLACK
+		c.Flip()
+	}
+
+	if !ProbeKPK(c.SideToMove == WHITE, bits.TrailingZeros64(c.Boards[WHITE_KING]), bits.TrailingZeros64(c.Boards[WHITE_PAWN]),
+		bits.TrailingZeros64(c.Boards[BLACK_KING])) {
+		return 0, true
+	}
+	return strong, true
+}
+
+func generateKPK() {
+	results := make([]uint8, KPK_SIZE)
+	for index := range results {
+		results[index] = classifyKPK(index)
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for index, result := range results {
+			if result == KPK_UNKNOWN {
+				results[index] = solveKPK(index, results)
+				changed = changed || results[index] != KPK_UNKNOWN
+			}
+		}
+	}
+
+	for index, result := range results {
+		if result == KPK_WIN {
+			kpk_bitbase[index/64] |= 1 << (index % 64)
+		}
+	}
+}
+
+// White pawn attacks
+func kpkPawnAttack(pawn int) uint64 {
+	board := uint64(1) << pawn
+	return ((board << 9) & ^FILE_MASK[7]) | ((board << 7) & ^FILE_MASK[0])
+}
+
+// Classify a position from the rules only
+func classifyKPK(index int) uint8 {
+	whiteToMove, whiteKing, pawn, blackKing := kpkPosition(index)
+
+	if Distance(whiteKing, blackKing) <= 1 || whiteKing == pawn || blackKing == pawn ||
+		(whiteToMove && IsPieceAtIndex(kpkPawnAttack(pawn), blackKing)) {
+		return KPK_INVALID
+	}
+
+	if whiteToMove {
+		//The pawn promote, and the new Queen cannot be captured
+		promotion := pawn + 8
+		if pawn/8 == 6 && promotion != whiteKing && promotion != blackKing &&
+			(Distance(blackKing, promotion) > 1 || Distance(whiteKing, promotion) == 1) {
+			return KPK_WIN
+		}
+		return KPK_UNKNOWN
+	}
+
+	//Black capture the pawn
+	if Distance(blackKing, pawn) == 1 && Distance(whiteKing, pawn) > 1 {
+		return KPK_DRAW
+	}
+
+	//Black has no move: stalemate, or checkmate by the pawn
+	if blackKPKMoves(whiteKing, pawn, blackKing) == 0 {
+		if IsPieceAtIndex(kpkPawnAttack(pawn), blackKing) {
+			return KPK_WIN
+		}
+		return KPK_DRAW
+	}
+
+	return KPK_UNKNOWN
+}
+
+// Squares the black King can move to (the pawn square is not included, the capture is handled by classifyKPK)
+func blackKPKMoves(whiteKing, pawn, blackKing int) uint64 {
+	return KING_ATTACK[blackKing] & ^KING_ATTACK[whiteKing] & ^kpkPawnAttack(pawn) & ^(uint64(1) << pawn)
+}
+
+// Solve a position from its successors
+func solveKPK(index int, results []uint8) uint8 {
+	whiteToMove, whiteKing, pawn, blackKing := kpkPosition(index)
+
+	var successors []int
+	if whiteToMove {
+		moves := KING_ATTACK[whiteKing] & ^KING_ATTACK[blackKing] & ^(uint64(1) << pawn)
+		for moves != 0 {
+			to := bits.TrailingZeros64(moves)
+			ClearBit(to, &moves)
+			successors = append(successors, kpkIndex(false, to, pawn, blackKing))
+		}
+
+		//Pawn push (the promotion is handled by classifyKPK)
+		push := pawn + 8
+		if pawn/8 < 6 && push != whiteKing && push != blackKing {
+			successors = append(successors, kpkIndex(false, whiteKing, push, blackKing))
+			double := push + 8
+			if pawn/8 == 1 && double != whiteKing && double != blackKing {
+				successors = append(successors, kpkIndex(false, whiteKing, double, blackKing))
+			}
+		}
+	} else {
+		moves := blackKPKMoves(whiteKing, pawn, blackKing)
+		for moves != 0 {
+			to := bits.TrailingZeros64(moves)
+			ClearBit(to, &moves)
+			successors = append(successors, kpkIndex(true, whiteKing, pawn, to))
+		}
+	}
+
+	//The side to move choose its best result (the invalid successors are illegal moves): White look for a win, Black for a draw
+	good, bad := uint8(KPK_WIN), uint8(KPK_DRAW)
+	if !whiteToMove {
+		good, bad = KPK_DRAW, KPK_WIN
+	}
+	all := true
+	for _, successor := range successors {
+		switch results[successor] {
+		case good:
+			return good
+		case KPK_UNKNOWN:
+			all = false
+		}
+	}
+	if all {
+		return bad
+	}
+	return KPK_UNKNOWN
+}
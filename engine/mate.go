@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"time"
+)
+
+/*
+ * Mate finder. Unlike the normal search, there is no evaluation here: a node is either a proven mate or not,
+ * so the result is a guarantee. The attacker try its moves with checks first (then captures), and on its last
+ * move only checking moves are tried since a mate is always a check. The defender must be mated after every reply.
+ * We try mate in 1, 2, ..., n so the attacker always play the shortest mate, and the defender play the reply
+ * that delay the mate the longest, which give the main line of the mate
+ */
+
+// Find a forced mate in at most n moves for the side to move, starting with one of the root moves (nil for all the
+// legal moves), and return the mating line.
+// If it return false and the search was not stopped, there is no mate in n (the mate is refuted)
+func (job *SearchJob) MateSearch(n int, moves []Move, info func(SearchInfo)) ([]Move, bool) {
+	for k := 1; k <= n; k++ {
+		line, found := job.attack(job.chess, k, moves)
+		if job.stopped.Load() {
+			return nil, false
+		}
+		if found {
+			if info != nil {
+				info(SearchInfo{Depth: 2*k - 1, Nodes: job.nodes, Time: time.Since(job.start),
+					Lines: []Line{{Move: line[0], Score: MATE - len(line), PV: line}}})
+			}
+			return line, true
+		}
+	}
+
+	return nil, false
+}
+
+// Convenient version of the mate finder for one-off calls (CLI, web server)
+func (chess *Chess) FindMate(n int) ([]Move, bool) {
+	return NewSearchJob(chess, SearchLimits{}, nil).MateSearch(n, nil, nil)
+}
+
+// Attacker to move: find a move (among moves, nil for all the legal moves) that mate in at most n moves
+func (job *SearchJob) attack(chess *Chess, n int, moves []Move) ([]Move, bool) {
+	job.countNode()
+	if job.stopped.Load() {
+		return nil, false
+	}
+
+	for _, child := range job.orderMateMoves(chess, moves, n == 1) {
+		if line, mated := job.defend(child.chess, n); mated {
+			return append([]Move{child.move}, line...), true
+		}
+	}
+
+	return nil, false
+}
+
+// Defender to move, after n attacker moves are played (including the last one): check if every reply get mated
+// in the remaining n - 1 moves, and return the line of the reply that last the longest
+func (job *SearchJob) defend(chess *Chess, n int) ([]Move, bool) {
+	job.countNode()
+	if job.stopped.Load() {
+		return nil, false
+	}
+
+	moves := chess.MoveGeneration()
+	if len(moves) == 0 {
+		return nil, chess.IsChecked() || chess.IsVariantEnd() // Checkmate (or won by the variant), or stalemate which is not a mate
+	}
+	if n == 1 {
+		return nil, false
+	}
+
+	var (
+		longest    []Move
+		longestLen = -1
+	)
+	for _, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+
+		//Shortest mate after this reply
+		found := false
+		for k := 1; k < n; k++ {
+			line, mated := job.attack(clone, k, nil)
+			if mated {
+				if k > longestLen {
+					longest, longestLen = append([]Move{move}, line...), k
+				}
+				found = true
+				break
+			}
+			if job.stopped.Load() {
+				return nil, false
+			}
+		}
+		if !found {
+			return nil, false // This reply escape the mate
+		}
+	}
+
+	return longest, true
+}
+
+type mateChild struct {
+	move  Move
+	chess *Chess
+}
+
+// Generate the attacker's children (from moves, nil for all the legal moves) with checking moves first, then
+// captures, then quiet moves. If onlyChecks is set, the non checking moves are dropped
+func (job *SearchJob) orderMateMoves(chess *Chess, moves []Move, onlyChecks bool) []mateChild {
+	var checks, captures, quiets []mateChild
+
+	if moves == nil {
+		moves = chess.MoveGeneration()
+	}
+	for _, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		child := mateChild{move: move, chess: clone}
+
+		switch {
+		case clone.IsChecked() || clone.IsVariantEnd():
+			checks = append(checks, child)
+		case onlyChecks:
+		case chess.IsCapture(move):
+			captures = append(captures, child)
+		default:
+			quiets = append(quiets, child)
+		}
+	}
+
+	return append(append(checks, captures...), quiets...)
+}
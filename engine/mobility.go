@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"math/bits"
+)
+
+/*
+ * Piece activity and king safety. Both use the attacks of the pieces, so they are calculated in the same pass:
+ * - Mobility: number of safe squares a piece attack (not occupied by own pieces, not attacked by enemy pawns),
+ *   compared to the average mobility of the piece type
+ * - King safety: the pieces attacking the zone around the enemy King (the King square and the squares next to it).
+ *   The attack is only dangerous with several attackers, so the weight of the attacked squares is scaled
+ *   by the number of attackers. Then the pawn shield in front of the King and the open files near it
+ * King safety only matter in the middlegame, the tapered evaluation fade it out in the endgame
+ */
+
+// Evaluate the mobility and the king safety, from White perspective
+func (chess *Chess) EvaluateActivity() (int, int) {
+	e := evaluation{params: chess.EvalParams()}
+	chess.evaluateActivity(&e)
+	return e.mg, e.eg
+}
+
+func (chess *Chess) evaluateActivity(e *evaluation) {
+	chess.sideActivity(WHITE, e)
+	chess.sideActivity(BLACK, e)
+	if chess.Boards[WHITE_KING] != 0 { //No King in Horde
+		pawnShield(chess.Boards[WHITE_KING], chess.Boards[WHITE_PAWN], chess.Boards[BLACK_PAWN], WHITE, e)
+	}
+	pawnShield(FlipVertical(chess.Boards[BLACK_KING]), FlipVertical(chess.Boards[BLACK_PAWN]), FlipVertical(chess.Boards[WHITE_PAWN]), BLACK, e)
+}
+
+// Mobility of the pieces of one side, and the danger they create around the enemy King
+func (chess *Chess) sideActivity(side int, e *evaluation) {
+	var (
+		offset, enemyOffset = 0, 6
+		own                 = chess.GenerateAllWhites()
+		enemyPawnAttack     = ((chess.Boards[BLACK_PAWN] >> 9) & ^FILE_MASK[0]) | ((chess.Boards[BLACK_PAWN] >> 7) & ^FILE_MASK[7])
+	)
+	if side == BLACK {
+		offset, enemyOffset = 6, 0
+		own = chess.GenerateAllBlacks()
+		enemyPawnAttack = ((chess.Boards[WHITE_PAWN] << 9) & ^FILE_MASK[7]) | ((chess.Boards[WHITE_PAWN] << 7) & ^FILE_MASK[0])
+	}
+
+	var (
+		mg, eg              int
+		attackers, weight   int
+		safe                = ^own & ^enemyPawnAttack
+		enemyKing           = chess.Boards[WHITE_KING+enemyOffset]
+		kingZone            = enemyKing
+		board, attack       uint64
+		index, count, piece int
+	)
+	if enemyKing != 0 {
+		kingZone |= KING_ATTACK[bits.TrailingZeros64(enemyKing)]
+	}
+
+	for _, piece = range []int{WHITE_KNIGHT, WHITE_BISHOP, WHITE_ROOK, WHITE_QUEEN} {
+		board = chess.Boards[piece+offset]
+		for board != 0 {
+			index = bits.TrailingZeros64(board)
+			ClearBit(index, &board)
+
+			switch piece {
+			case WHITE_KNIGHT:
+				attack = KNIGHT_ATTACK[index]
+			case WHITE_BISHOP:
+				attack = chess.DAndAntiDMoves(index)
+			case WHITE_ROOK:
+				attack = chess.HAndVMoves(index)
+			case WHITE_QUEEN:
+				attack = chess.HAndVMoves(index) | chess.DAndAntiDMoves(index)
+			}
+
+			count = bits.OnesCount64(attack & safe)
+			mg += (count - e.params.MobilityAverage[piece]) * e.params.MobilityMG[piece]
+			eg += (count - e.params.MobilityAverage[piece]) * e.params.MobilityEG[piece]
+
+			if attack&kingZone != 0 {
+				attackers++
+				weight += bits.OnesCount64(attack&kingZone) * e.params.KingAttackWeight[piece]
+			}
+		}
+	}
+	e.add("mobility", side, mg, eg)
+
+	//The King safety is a middlegame term
+	e.add("king attack", side, weight*e.params.KingAttackersScale[Min(attackers, 7)]/100, 0)
+}
+
+// Pawn shield and open files around the King of the side moving up the board (middlegame terms)
+func pawnShield(king, own, enemy uint64, side int, e *evaluation) {
+	var (
+		index         = bits.TrailingZeros64(king)
+		rank          = index / 8
+		shield, files int
+	)
+
+	for f := Max(index%8-1, 0); f <= Min(index%8+1, 7); f++ {
+		file := FILE_MASK[7-f]
+
+		//Only a King on its first 2 ranks is sheltered by its pawns
+		if rank <= 1 {
+			if own&file&RANK_MASK[rank+1] != 0 {
+				shield += e.params.PawnShieldClose
+			} else if own&file&RANK_MASK[rank+2] != 0 {
+				shield += e.params.PawnShieldFar
+			}
+		}
+
+		if own&file == 0 {
+			files += e.params.KingSemiOpenFile
+			if enemy&file == 0 {
+				files += e.params.KingOpenFile
+			}
+		}
+	}
+
+	e.add("pawn shield", side, shield, 0)
+	e.add("king open files", side, files, 0)
+}
@@ -2,6 +2,8 @@ package engine
 
 import (
 	"fmt"
+	"math/bits"
+	"strings"
 	"sync"
 )
 
@@ -11,9 +13,14 @@ type Move struct {
 	FromIndex int
 	ToBoard   int
 	ToIndex   int
+	Drop      bool // Crazyhouse drop of a piece from the pocket: FromBoard = ToBoard and FromIndex = ToIndex
 }
 
 func (move Move) String() string {
+	if move.Drop {
+		return pocket_letter[move.ToBoard%6] + "@" + FromIndexToAlgebraic(move.ToIndex)
+	}
+
 	switch move.Castling {
 	case WHITE_KING_SIDE:
 		return "O-O"
@@ -51,6 +58,69 @@ func (move Move) String() string {
 	}
 }
 
+// Check if the move capture a piece (including en passant) in this position
+func (chess *Chess) IsCapture(move Move) bool {
+	if move.Castling != 0 {
+		return false
+	}
+	if (move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN) && move.ToIndex == chess.EnPassantTarget {
+		return true
+	}
+	return IsPieceAtIndex(chess.GenerateAllWhites()|chess.GenerateAllBlacks(), move.ToIndex)
+}
+
+// Convert the move to UCI long algebraic notation (e2e4, e7e8q, e1g1 for castling, N@f3 for a drop). A Chess960 castling with
+// the King or the Rook not on its standard square is written as the King capturing its Rook, like in UCI960
+func (move Move) UCI() string {
+	if move.Drop {
+		return move.String() // P@e4, the piece is always in uppercase
+	}
+	if move.Castling != 0 && !move.isStandardCastling() {
+		return move.UCI960()
+	}
+
+	switch move.Castling {
+	case WHITE_KING_SIDE:
+		return "e1g1"
+	case WHITE_QUEEN_SIDE:
+		return "e1c1"
+	case BLACK_KING_SIDE:
+		return "e8g8"
+	case BLACK_QUEEN_SIDE:
+		return "e8c8"
+	default:
+		return strings.ToLower(move.String())
+	}
+}
+
+// Convert the move to the notation of UCI in Chess960 mode: castling is written as the King capturing its Rook (e1h1)
+func (move Move) UCI960() string {
+	if move.Castling == 0 {
+		return move.UCI()
+	}
+
+	//Castling moves made by NewMove don't have the squares, they are the standard castling
+	from, to := move.FromIndex, move.ToIndex
+	if from == to {
+		from = 3
+		if move.Castling == BLACK_KING_SIDE || move.Castling == BLACK_QUEEN_SIDE {
+			from = 59
+		}
+		to = DEFAULT_CASTLING_ROOKS[castlingIndex(move.Castling)]
+	}
+	return FromIndexToAlgebraic(from) + FromIndexToAlgebraic(to)
+}
+
+// Check if a castling move has the King and the Rook on their standard squares (or no squares, see NewMove)
+func (move Move) isStandardCastling() bool {
+	king := 3
+	if move.Castling == BLACK_KING_SIDE || move.Castling == BLACK_QUEEN_SIDE {
+		king = 59
+	}
+	return move.FromIndex == move.ToIndex ||
+		(move.FromIndex == king && move.ToIndex == DEFAULT_CASTLING_ROOKS[castlingIndex(move.Castling)])
+}
+
 func NewMove(chess *Chess, str string) Move {
 	switch str {
 	case "O-O":
@@ -62,6 +132,16 @@ func NewMove(chess *Chess, str string) Move {
 	case "o-o-o":
 		return Move{Castling: BLACK_QUEEN_SIDE}
 	default:
+		//Crazyhouse drop (N@f3), the piece has the color of the side to move
+		if len(str) == 4 && str[1] == '@' {
+			piece := strings.Index("PRNBQ", strings.ToUpper(str[:1]))
+			if chess.SideToMove == BLACK {
+				piece += 6
+			}
+			index := FromAlgebraicToIndex(str[2:])
+			return Move{Drop: true, FromBoard: piece, FromIndex: index, ToBoard: piece, ToIndex: index}
+		}
+
 		move := Move{Castling: 0}
 		move.FromIndex = FromAlgebraicToIndex(str[:2])
 		move.ToIndex = FromAlgebraicToIndex(str[2:4])
@@ -128,44 +208,66 @@ func NewMove(chess *Chess, str string) Move {
 // Mapping for castling (to avoid if else)
 var (
 	/*
-	 * Mapping for the castling operation. Each element in the array are:
-	 * Initial rook position
+	 * Mapping for the castling operation. The King and the Rook always end on the same squares (also in Chess960),
+	 * their initial squares are found from the position. Each element in the array are:
 	 * New rook position
-	 * Initial king position
 	 * New king position
 	 * Castling turn off bitmask
 	 */
-	csMapping = map[int][5]int{
-		WHITE_KING_SIDE:  {0, 2, 3, 1, 3},
-		WHITE_QUEEN_SIDE: {7, 4, 3, 5, 3},
-		BLACK_KING_SIDE:  {56, 58, 59, 57, 12},
-		BLACK_QUEEN_SIDE: {63, 60, 59, 61, 12},
+	csMapping = map[int][3]int{
+		WHITE_KING_SIDE:  {2, 1, 3},
+		WHITE_QUEEN_SIDE: {4, 5, 3},
+		BLACK_KING_SIDE:  {58, 57, 12},
+		BLACK_QUEEN_SIDE: {60, 61, 12},
 	}
 )
 
+// Initial squares of the castling Rooks in standard chess: h1, a1, h8, a8
+var DEFAULT_CASTLING_ROOKS = [4]int{0, 7, 56, 63}
+
+// Index of a castling privilege in CastlingRooks: K, Q, k, q
+func castlingIndex(cs int) int {
+	return 3 - bits.TrailingZeros(uint(cs))
+}
+
 // Method to perform castling
 func (chess *Chess) Castling(cs int) {
+	//Castling is not an irreversible move for the fifty-move rule, so the current position stay in the history
+	chess.history = &historyNode{hash: chess.Hash(), prev: chess.history}
+
 	//Set en passant target, full move and half move
+	chess.hashEnPassant(chess.EnPassantTarget)
 	chess.EnPassantTarget = -1
 	chess.Halfmove++
 
-	if cs == WHITE_KING_SIDE || cs == WHITE_QUEEN_SIDE {
-		ClearBit(csMapping[cs][0], &chess.Boards[WHITE_ROOK])
-		SetBit(csMapping[cs][1], &chess.Boards[WHITE_ROOK])
-		ClearBit(csMapping[cs][2], &chess.Boards[WHITE_KING])
-		SetBit(csMapping[cs][3], &chess.Boards[WHITE_KING])
-	} else {
-		ClearBit(csMapping[cs][0], &chess.Boards[BLACK_ROOK])
-		SetBit(csMapping[cs][1], &chess.Boards[BLACK_ROOK])
-		ClearBit(csMapping[cs][2], &chess.Boards[BLACK_KING])
-		SetBit(csMapping[cs][3], &chess.Boards[BLACK_KING])
+	rook, king := WHITE_ROOK, WHITE_KING
+	if cs == BLACK_KING_SIDE || cs == BLACK_QUEEN_SIDE {
+		rook, king = BLACK_ROOK, BLACK_KING
 
 		//Only Black turn that full move can increase
 		chess.Fullmove++
 	}
 
+	//Remove both pieces before placing them, since in Chess960 a piece can land on the other's initial square
+	var (
+		rookIndex = chess.CastlingRooks[castlingIndex(cs)]
+		kingIndex = bits.TrailingZeros64(chess.Boards[king])
+	)
+	ClearBit(rookIndex, &chess.Boards[rook])
+	chess.updatePiece(rook, rookIndex)
+	ClearBit(kingIndex, &chess.Boards[king])
+	chess.updatePiece(king, kingIndex)
+	SetBit(csMapping[cs][0], &chess.Boards[rook])
+	chess.updatePiece(rook, csMapping[cs][0])
+	SetBit(csMapping[cs][1], &chess.Boards[king])
+	chess.updatePiece(king, csMapping[cs][1])
+
 	chess.SideToMove = WHITE + BLACK - chess.SideToMove
-	chess.CastlingPrivilege &= csMapping[cs][4]
+	chess.hashSideToMove()
+	chess.hashCastling(chess.CastlingPrivilege)
+	chess.CastlingPrivilege &= csMapping[cs][2]
+	chess.hashCastling(chess.CastlingPrivilege)
+	chess.updateVariantState()
 }
 
 // Makemove method. Here, we assume that the move is a valid move: correct move syntax, correct turn and valid move
@@ -174,76 +276,109 @@ func (chess *Chess) MakeMove(move Move) {
 		chess.Castling(move.Castling)
 		return
 	}
+	if move.Drop {
+		chess.Drop(move)
+		return
+	}
+
+	//Record the position before the move, for repetition detection
+	previous := chess.Hash()
 
 	//Move the piece
 	ClearBit(move.FromIndex, &chess.Boards[move.FromBoard])
+	chess.updatePiece(move.FromBoard, move.FromIndex)
 
-	//Place the piece down
-	SetBit(move.ToIndex, &chess.Boards[move.ToBoard])
-
-	//Calculate capture index and remove the capture piece
+	//Calculate capture index and remove the capture piece (en passant is a pawn move, so it doesn't need to be a capture here)
 	captureIndex := move.ToIndex
+	isCapture := false
+	captured := -1
 	if chess.SideToMove == WHITE {
 		if move.FromBoard == WHITE_PAWN && move.ToIndex == chess.EnPassantTarget {
 			captureIndex = chess.EnPassantTarget - 8
 			ClearBit(captureIndex, &chess.Boards[BLACK_PAWN])
+			chess.updatePiece(BLACK_PAWN, captureIndex)
+			captured = BLACK_PAWN
 		} else {
 			for i := BLACK_PAWN; i < BLACK_KING; i++ { //King capturing normally not happen, so we ignore it here
-				ClearBit(captureIndex, &chess.Boards[i])
+				if IsPieceAtIndex(chess.Boards[i], captureIndex) {
+					ClearBit(captureIndex, &chess.Boards[i])
+					chess.updatePiece(i, captureIndex)
+					isCapture = true
+					captured = i
+				}
 			}
 		}
 	} else {
 		if move.FromBoard == BLACK_PAWN && move.ToIndex == chess.EnPassantTarget {
 			captureIndex = chess.EnPassantTarget + 8
 			ClearBit(captureIndex, &chess.Boards[WHITE_PAWN])
+			chess.updatePiece(WHITE_PAWN, captureIndex)
+			captured = WHITE_PAWN
 		} else {
 			for i := WHITE_PAWN; i < WHITE_KING; i++ {
-				ClearBit(captureIndex, &chess.Boards[i])
+				if IsPieceAtIndex(chess.Boards[i], captureIndex) {
+					ClearBit(captureIndex, &chess.Boards[i])
+					chess.updatePiece(i, captureIndex)
+					isCapture = true
+					captured = i
+				}
 			}
 		}
 	}
 
+	//Place the piece down
+	SetBit(move.ToIndex, &chess.Boards[move.ToBoard])
+	chess.updatePiece(move.ToBoard, move.ToIndex)
+	switch {
+	case chess.Variant == CRAZYHOUSE:
+		chess.updatePocket(move, captured, captureIndex)
+	case chess.Variant == ATOMIC && captured != -1:
+		chess.explode(move.ToIndex)
+	}
+
 	//Re-calculate game state
-	if (move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN) && (Abs(move.ToIndex-move.FromIndex)) == 16 {
+	chess.hashEnPassant(chess.EnPassantTarget)
+	//The double step of a Horde pawn from the first rank can't be taken en passant
+	if (move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN) && (Abs(move.ToIndex-move.FromIndex)) == 16 &&
+		(move.FromIndex/8 == 1 || move.FromIndex/8 == 6) {
 		chess.EnPassantTarget = (move.ToIndex + move.FromIndex) / 2
 	} else {
 		chess.EnPassantTarget = -1
 	}
+	chess.hashEnPassant(chess.EnPassantTarget)
 
-	if !IsPieceAtIndex(chess.Boards[WHITE_KING], 3) {
+	//A King move lose both castling privileges, and a Rook that move or is captured lose its own
+	chess.hashCastling(chess.CastlingPrivilege)
+	switch move.FromBoard {
+	case WHITE_KING:
 		chess.CastlingPrivilege &= 3
-	} else {
-		if !IsPieceAtIndex(chess.Boards[WHITE_ROOK], 0) {
-			chess.CastlingPrivilege &= 7
-		}
-
-		if !IsPieceAtIndex(chess.Boards[WHITE_ROOK], 7) {
-			chess.CastlingPrivilege &= 11
-		}
-	}
-
-	if !IsPieceAtIndex(chess.Boards[BLACK_KING], 59) {
+	case BLACK_KING:
 		chess.CastlingPrivilege &= 12
-	} else {
-		if !IsPieceAtIndex(chess.Boards[BLACK_ROOK], 56) {
-			chess.CastlingPrivilege &= 13
-		}
-
-		if !IsPieceAtIndex(chess.Boards[BLACK_ROOK], 63) {
-			chess.CastlingPrivilege &= 14
+	}
+	for _, cs := range []int{WHITE_KING_SIDE, WHITE_QUEEN_SIDE, BLACK_KING_SIDE, BLACK_QUEEN_SIDE} {
+		if rook := chess.CastlingRooks[castlingIndex(cs)]; move.FromIndex == rook || move.ToIndex == rook {
+			chess.CastlingPrivilege &^= cs
 		}
 	}
+	chess.hashCastling(chess.CastlingPrivilege)
 
 	chess.SideToMove = WHITE + BLACK - chess.SideToMove
-	if move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN || IsPieceAtIndex(chess.GenerateAllBlacks(), captureIndex) {
+	chess.hashSideToMove()
+	if move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN || isCapture {
+		//Irreversible move: the positions before can never be repeated
 		chess.Halfmove = 0
+		chess.history = nil
 	} else {
 		chess.Halfmove++
+		chess.history = &historyNode{hash: previous, prev: chess.history}
 	}
 
-	if chess.SideToMove == BLACK {
+	//Only Black turn that full move can increase. The side to move was already switched above, so White to move
+	//means Black just played (the counter used to be increased after White moves, and the FENs of the history were off)
+	if chess.SideToMove == WHITE {
 		chess.Fullmove++
 	}
+	chess.updateVariantState()
 }
 
 // Perft method: return all move found in the n-depthed search tree. We use copy here instead of Make/Unmake. This is a single threaded version
@@ -341,3 +476,14 @@ func (chess *Chess) FastPerft(depth int) (map[string]int, int) {
 
 	return result, total
 }
+
+// Find the legal move matching the UCI string (e2e4, e7e8q, e1g1, the Chess960 e1h1 or the drop N@f3) in the current position
+func (chess *Chess) ParseUCIMove(str string) (Move, error) {
+	str = strings.ToLower(strings.TrimSpace(str))
+	for _, move := range chess.MoveGeneration() {
+		if strings.ToLower(move.UCI()) == str || move.UCI960() == str {
+			return move, nil
+		}
+	}
+	return Move{}, fmt.Errorf("illegal or malformed move '%s'", str)
+}
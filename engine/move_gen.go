@@ -86,9 +86,11 @@ func (chess *Chess) GenerateWhiteKingInDanger() uint64 {
 		ClearBit(index, &temp)
 	}
 
-	//Calculate for black king (there can be only 1 King -> no need for loop)
-	index = bits.TrailingZeros64(chess.Boards[BLACK_KING])
-	whiteInDanger |= KING_ATTACK[index] & blacks_empty_whiteKing
+	//Calculate for black king (there can be only 1 King -> no need for loop, and none in Horde)
+	if chess.Boards[BLACK_KING] != 0 {
+		index = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+		whiteInDanger |= KING_ATTACK[index] & blacks_empty_whiteKing
+	}
 
 	//Restore the value of whiteKing
 	chess.Boards[WHITE_KING] = wk
@@ -135,15 +137,20 @@ func (chess *Chess) GenerateWhiteAttacks() uint64 {
 		ClearBit(index, &temp)
 	}
 
-	//Calculate white king attack squares (since there is only one King, no need to use a loop)
-	index = bits.TrailingZeros64(chess.Boards[WHITE_KING])
-	whiteCanAttack |= KING_ATTACK[index] & whitesCanLandTo
+	//Calculate white king attack squares (since there is only one King, no need to use a loop, and none in Horde)
+	if chess.Boards[WHITE_KING] != 0 {
+		index = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		whiteCanAttack |= KING_ATTACK[index] & whitesCanLandTo
+	}
 
 	return whiteCanAttack
 }
 
 // Check if the White King is under attacked (is checked)
 func (chess *Chess) IsWhiteKingChecked() bool {
+	if chess.Variant == ATOMIC && chess.kingsTouch() {
+		return false //In Atomic, Kings next to each other are never in check
+	}
 	chess.Flip()
 	blackAttacks := FlipVertical(chess.GenerateWhiteAttacks())
 	chess.Flip()
@@ -151,9 +158,20 @@ func (chess *Chess) IsWhiteKingChecked() bool {
 }
 
 func (chess *Chess) IsBlackKingChecked() bool {
+	if chess.Variant == ATOMIC && chess.kingsTouch() {
+		return false
+	}
 	return chess.Boards[BLACK_KING]&chess.GenerateWhiteAttacks() != 0
 }
 
+// Check if the King of the side to move is under attacked
+func (chess *Chess) IsChecked() bool {
+	if chess.SideToMove == WHITE {
+		return chess.IsWhiteKingChecked()
+	}
+	return chess.IsBlackKingChecked()
+}
+
 func (chess *Chess) CalculateWhiteKingAttackers() (uint64, bool) {
 	var (
 		FILE_A, FILE_H = FILE_MASK[0], FILE_MASK[7]
@@ -583,6 +601,9 @@ func (chess *Chess) PseudoLegalMoves(wp, wr, wn, wb, wq uint64) []Move {
 	}
 
 	pawnMoves |= (wp << 16) & empty & (empty << 8) & RANK_4
+	if chess.Variant == HORDE {
+		pawnMoves |= ((wp & RANK_MASK[0]) << 16) & empty & (empty << 8) //Horde pawns of the first rank
+	}
 	for pawnMoves != 0 {
 		index = bits.TrailingZeros64(pawnMoves)
 		move.FromIndex, move.ToIndex, move.ToBoard = index-16, index, WHITE_PAWN
@@ -727,12 +748,33 @@ func (chess *Chess) WhiteMoveGeneration() []Move {
 		empty          = ^(whites | blacks)
 	)
 
+	//In Atomic, the captures explode the pieces around: the moves are verified one by one instead
+	if chess.Variant == ATOMIC {
+		return chess.AtomicMoveGeneration()
+	}
+
+	//Without King (Horde), there is no check and no pin: all pseudo legal moves are legal
+	if chess.Boards[WHITE_KING] == 0 {
+		moves = append(moves, chess.EnPassantMoves()...)
+		return append(moves, chess.PseudoLegalMoves(wp, wr, wn, wb, wq)...)
+	}
+
 	//Generate King moves
 	moves = append(moves, chess.WhiteKingMoves()...)
 
 	//Get King's attackers
 	attackers, hasSPAttacker := chess.CalculateWhiteKingAttackers()
 
+	//Crazyhouse drops: on any empty square, or in a single check only between the King and a sliding attacker
+	if chess.Variant == CRAZYHOUSE {
+		switch {
+		case attackers == 0:
+			moves = append(moves, chess.DropMoves(empty)...)
+		case bits.OnesCount64(attackers) == 1 && hasSPAttacker:
+			moves = append(moves, chess.DropMoves(blockingSquares(kingIndex, bits.TrailingZeros64(attackers)))...)
+		}
+	}
+
 	//If this is double check, or there is only the King left, then we stop here
 	if bits.OnesCount64(attackers) > 1 || wp|wr|wn|wb|wq == 0 {
 		return moves
@@ -885,22 +927,70 @@ func (chess *Chess) WhiteMoveGeneration() []Move {
 	moves = append(moves, pinPieceMoves...)
 
 	/*===Handling castling cases===*/
-	whiteKingInDanger := chess.GenerateWhiteKingInDanger()
-	move := Move{}
-	if (chess.CastlingPrivilege&int(WHITE_KING_SIDE)) == int(WHITE_KING_SIDE) && (empty&0x6) == 0x6 && (whiteKingInDanger&0xE) == 0 {
-		move.Castling = WHITE_KING_SIDE
-		moves = append(moves, move)
+	for _, cs := range []int{WHITE_KING_SIDE, WHITE_QUEEN_SIDE} {
+		if move, ok := chess.WhiteCastlingMove(cs); ok {
+			moves = append(moves, move)
+		}
 	}
 
-	if (chess.CastlingPrivilege&int(WHITE_QUEEN_SIDE)) == int(WHITE_QUEEN_SIDE) && (empty&0x70) == 0x70 && (whiteKingInDanger&0x38) == 0 {
-		move.Castling = WHITE_QUEEN_SIDE
-		moves = append(moves, move)
+	return moves
+}
+
+// Return the castling move of White if it's legal (the King must not be in check, this is verified by the caller).
+// The move keeps the King and Rook squares, since in Chess960 they can be on any file
+func (chess *Chess) WhiteCastlingMove(cs int) (Move, bool) {
+	if chess.CastlingPrivilege&cs == 0 {
+		return Move{}, false
 	}
 
-	return moves
+	var (
+		king   = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		rook   = chess.CastlingRooks[castlingIndex(cs)]
+		rookTo = csMapping[cs][0]
+		kingTo = csMapping[cs][1]
+	)
+	if king > 7 || !IsPieceAtIndex(chess.Boards[WHITE_ROOK], rook) {
+		return Move{}, false
+	}
+
+	//All the squares between the King, the Rook and their destinations must be empty, except for the King and the Rook
+	occupied := (chess.GenerateAllWhites() | chess.GenerateAllBlacks()) &^ (1<<king | 1<<rook)
+	if occupied&squaresBetween(min(king, rook, kingTo, rookTo), max(king, rook, kingTo, rookTo)) != 0 {
+		return Move{}, false
+	}
+
+	//The King cannot pass through or land on an attacked square. The Rook is removed first, it can hide an attack
+	//along the first rank on the King destination. In Atomic, the position after castling is verified by playing it,
+	//and there is no check next to the enemy King: the Rook stays, it only matter for the destination
+	var whiteKingInDanger uint64
+	if chess.Variant == ATOMIC {
+		whiteKingInDanger = chess.GenerateWhiteKingInDanger()
+		if chess.Boards[BLACK_KING] != 0 {
+			whiteKingInDanger &^= KING_ATTACK[bits.TrailingZeros64(chess.Boards[BLACK_KING])]
+		}
+	} else {
+		ClearBit(rook, &chess.Boards[WHITE_ROOK])
+		whiteKingInDanger = chess.GenerateWhiteKingInDanger()
+		SetBit(rook, &chess.Boards[WHITE_ROOK])
+	}
+	if whiteKingInDanger&squaresBetween(min(king, kingTo), max(king, kingTo)) != 0 {
+		return Move{}, false
+	}
+
+	return Move{Castling: cs, FromBoard: WHITE_KING, FromIndex: king, ToBoard: WHITE_KING, ToIndex: rook}, true
+}
+
+// Squares from index low to index high (both included)
+func squaresBetween(low, high int) uint64 {
+	return (uint64(1)<<(high+1) - 1) &^ (uint64(1)<<low - 1)
 }
 
 func (chess *Chess) MoveGeneration() []Move {
+	//A game won by the rules of the variant has no moves left
+	if chess.IsVariantEnd() {
+		return nil
+	}
+
 	if chess.SideToMove == BLACK {
 		chess.Flip()
 		moves := chess.WhiteMoveGeneration()
@@ -911,17 +1001,14 @@ func (chess *Chess) MoveGeneration() []Move {
 			switch move.Castling {
 			case WHITE_KING_SIDE:
 				move.Castling = BLACK_KING_SIDE
-				reflectMoves = append(reflectMoves, move)
 			case WHITE_QUEEN_SIDE:
 				move.Castling = BLACK_QUEEN_SIDE
-				reflectMoves = append(reflectMoves, move)
-			default:
-				move.FromBoard += 6
-				move.ToBoard += 6
-				move.FromIndex = FlipIndexVertical(move.FromIndex)
-				move.ToIndex = FlipIndexVertical(move.ToIndex)
-				reflectMoves = append(reflectMoves, move)
 			}
+			move.FromBoard += 6
+			move.ToBoard += 6
+			move.FromIndex = FlipIndexVertical(move.FromIndex)
+			move.ToIndex = FlipIndexVertical(move.ToIndex)
+			reflectMoves = append(reflectMoves, move)
 		}
 		return reflectMoves
 	}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+)
+
+/*
+ * NNUE evaluation (efficiently updatable neural network). The network is a simple 768 -> 2xH -> 1 perspective network:
+ * - Input: one feature per (piece, square), 12 x 64 = 768 features, seen from each side. From White perspective the
+ *   feature of a piece is piece*64 + index, from Black perspective the colors are swapped and the board is flipped
+ *   vertically, so both perspectives share the same weights
+ * - Hidden layer: one accumulator of H values per perspective, the feature bias plus the weights of the active features.
+ *   MakeMove only add or remove the weights of the pieces that moved, so the accumulators are never recalculated
+ *   during the search. Flip swap both accumulators, like the hashes
+ * - Output: the accumulators of the side to move and of the other side go through a clipped ReLU (0 to NNUE_QA),
+ *   then a dot product with the output weights, plus the output bias
+ * Everything is integer: the feature weights are quantized by NNUE_QA, the output weights by NNUE_QB
+ *
+ * Binary weight format (all values little-endian):
+ *   [4]byte  magic "SRNN"
+ *   uint32   version (NNUE_VERSION)
+ *   uint32   hidden size H
+ *   int16    feature weights, 768 x H (the H weights of feature 0 first, then feature 1, ...)
+ *   int16    feature bias, H
+ *   int16    output weights, 2 x H (the side to move half first)
+ *   int32    output bias (quantized by NNUE_QA x NNUE_QB)
+ */
+
+const (
+	NNUE_VERSION  = 1
+	NNUE_FEATURES = 768
+	NNUE_QA       = 255 // Quantization of the feature weights and bias (clipped ReLU maximum)
+	NNUE_QB       = 64  // Quantization of the output weights
+	NNUE_SCALE    = 400 // Network output to centipawn
+)
+
+var nnue_magic = [4]byte{'S', 'R', 'N', 'N'}
+
+type Network struct {
+	Hidden         int
+	FeatureWeights []int16
+	FeatureBias    []int16
+	OutputWeights  []int16
+	OutputBias     int32
+}
+
+// Create a network with the given hidden size and all weights set to zero
+func NewNetwork(hidden int) *Network {
+	return &Network{
+		Hidden:         hidden,
+		FeatureWeights: make([]int16, NNUE_FEATURES*hidden),
+		FeatureBias:    make([]int16, hidden),
+		OutputWeights:  make([]int16, 2*hidden),
+	}
+}
+
+// Load a network from a file in the binary weight format
+func LoadNetwork(path string) (*Network, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		reader = bufio.NewReader(file)
+		header struct {
+			Magic   [4]byte
+			Version uint32
+			Hidden  uint32
+		}
+	)
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("invalid network header: %v", err)
+	}
+	if header.Magic != nnue_magic {
+		return nil, errors.New("not a Serina network file")
+	}
+	if header.Version != NNUE_VERSION {
+		return nil, fmt.Errorf("unsupported network version %d", header.Version)
+	}
+	if header.Hidden == 0 || header.Hidden > 1<<16 {
+		return nil, fmt.Errorf("invalid hidden size %d", header.Hidden)
+	}
+
+	network := NewNetwork(int(header.Hidden))
+	for _, data := range []any{network.FeatureWeights, network.FeatureBias, network.OutputWeights, &network.OutputBias} {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return nil, fmt.Errorf("truncated network file: %v", err)
+		}
+	}
+
+	return network, nil
+}
+
+// Save the network to a file in the binary weight format
+func (network *Network) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, data := range []any{nnue_magic, uint32(NNUE_VERSION), uint32(network.Hidden), network.FeatureWeights,
+		network.FeatureBias, network.OutputWeights, network.OutputBias} {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Hidden layer values of both perspectives (0 for White, 1 for Black)
+type Accumulator struct {
+	values [2][]int16
+}
+
+func newAccumulator(hidden int) *Accumulator {
+	values := make([]int16, 2*hidden)
+	return &Accumulator{values: [2][]int16{values[:hidden], values[hidden:]}}
+}
+
+func (accumulator *Accumulator) clone() *Accumulator {
+	clone := newAccumulator(len(accumulator.values[0]))
+	copy(clone.values[0], accumulator.values[0])
+	copy(clone.values[1], accumulator.values[1])
+	return clone
+}
+
+// Feature index of a piece on a square, from White (0) or Black (1) perspective
+func nnueFeature(perspective, piece, index int) int {
+	if perspective == 1 {
+		return ((piece+6)%12)*64 + FlipIndexVertical(index)
+	}
+	return piece*64 + index
+}
+
+// Add (or remove) the weights of a piece on a square to both accumulators
+func (accumulator *Accumulator) update(network *Network, piece, index int, add bool) {
+	for perspective := range 2 {
+		values := accumulator.values[perspective]
+		offset := nnueFeature(perspective, piece, index) * network.Hidden
+		weights := network.FeatureWeights[offset : offset+network.Hidden]
+		if add {
+			for i := range values {
+				values[i] += weights[i]
+			}
+		} else {
+			for i := range values {
+				values[i] -= weights[i]
+			}
+		}
+	}
+}
+
+// Return the network used by Evaluate, nil if the handcrafted evaluation is used
+func (chess *Chess) Network() *Network {
+	return chess.network
+}
+
+// Choose the evaluation: the network, or the handcrafted evaluation if network is nil
+func (chess *Chess) SetNetwork(network *Network) {
+	chess.network = network
+	chess.refreshAccumulator()
+}
+
+// Recalculate the accumulators from scratch (after the position is set up directly, like in FEN)
+func (chess *Chess) refreshAccumulator() {
+	if chess.network == nil {
+		chess.accumulator = nil
+		return
+	}
+
+	chess.accumulator = newAccumulator(chess.network.Hidden)
+	copy(chess.accumulator.values[0], chess.network.FeatureBias)
+	copy(chess.accumulator.values[1], chess.network.FeatureBias)
+	for piece := WHITE_PAWN; piece <= BLACK_KING; piece++ {
+		board := chess.Boards[piece]
+		for board != 0 {
+			index := bits.TrailingZeros64(board)
+			chess.accumulator.update(chess.network, piece, index, true)
+			ClearBit(index, &board)
+		}
+	}
+}
+
+// Evaluate the position with the network, from White perspective
+func (chess *Chess) EvaluateNNUE() int {
+	var (
+		network = chess.network
+		us      = 0
+		output  = int64(0)
+	)
+	if chess.SideToMove == BLACK {
+		us = 1
+	}
+
+	for i, value := range chess.accumulator.values[us] {
+		output += int64(clippedReLU(value)) * int64(network.OutputWeights[i])
+	}
+	for i, value := range chess.accumulator.values[1-us] {
+		output += int64(clippedReLU(value)) * int64(network.OutputWeights[network.Hidden+i])
+	}
+	score := int((output + int64(network.OutputBias)) * NNUE_SCALE / (NNUE_QA * NNUE_QB))
+
+	if chess.SideToMove == BLACK {
+		return -score
+	}
+	return score
+}
+
+func clippedReLU(value int16) int16 {
+	return min(max(value, 0), NNUE_QA)
+}
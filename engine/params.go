@@ -0,0 +1,301 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+)
+
+/*
+ * Evaluation parameters. Every weight of the evaluation is here, so we can load another set of weights from a JSON file
+ * and experiment without recompiling. Each Chess use its own parameters (the default ones if it has none),
+ * and the search use the parameters of the position it search.
+ * The arrays by piece type are indexed like the White boards: pawn, rook, knight, bishop, queen, king.
+ * The piece-square tables are from White perspective and start from a8 (a8, b8, ..., h8, a7, ..., h1)
+ */
+
+type EvalParams struct {
+	//Material value of each piece type in the middlegame and in the endgame (centipawn)
+	MaterialMG [6]int `json:"material_mg"`
+	MaterialEG [6]int `json:"material_eg"`
+
+	//Piece-square value in the middlegame and in the endgame
+	PieceSquareMG [6][64]int `json:"piece_square_mg"`
+	PieceSquareEG [6][64]int `json:"piece_square_eg"`
+
+	//Weight of each piece type in the game phase. A full set of pieces (without pawns) add up to TOTAL_PHASE
+	PhaseWeight [6]int `json:"phase_weight"`
+
+	//Material bonus (not tapered)
+	BishopPair int `json:"bishop_pair"`
+	KnightPair int `json:"knight_pair"`
+	RookPair   int `json:"rook_pair"`
+	QueenPair  int `json:"queen_pair"`
+	NoPawn     int `json:"no_pawn"`
+
+	//Pawn structure
+	DoubledPawnMG   int    `json:"doubled_pawn_mg"` // For each extra pawn on the same file
+	DoubledPawnEG   int    `json:"doubled_pawn_eg"`
+	IsolatedPawnMG  int    `json:"isolated_pawn_mg"`
+	IsolatedPawnEG  int    `json:"isolated_pawn_eg"`
+	BackwardPawnMG  int    `json:"backward_pawn_mg"`
+	BackwardPawnEG  int    `json:"backward_pawn_eg"`
+	ConnectedPawnMG [8]int `json:"connected_pawn_mg"` // By relative rank
+	ConnectedPawnEG [8]int `json:"connected_pawn_eg"`
+	PassedPawnMG    [8]int `json:"passed_pawn_mg"`
+	PassedPawnEG    [8]int `json:"passed_pawn_eg"`
+	PassedPawnFree  [8]int `json:"passed_pawn_free"` // Endgame, no piece in front of the passed pawn
+
+	//Endgame bonus (per square of distance) for the enemy King being far from, and the own King being close to,
+	//the square in front of a passed pawn. It is scaled by how advanced the pawn is
+	PassedPawnEnemyKing int `json:"passed_pawn_enemy_king"`
+	PassedPawnOwnKing   int `json:"passed_pawn_own_king"`
+
+	//Score per safe square above (or below) the average mobility of the piece type, and the average mobility
+	MobilityMG      [6]int `json:"mobility_mg"`
+	MobilityEG      [6]int `json:"mobility_eg"`
+	MobilityAverage [6]int `json:"mobility_average"`
+
+	//Weight of each square of the enemy King zone attacked by a piece, and the percentage of the total weight
+	//that is counted by number of attackers
+	KingAttackWeight   [6]int `json:"king_attack_weight"`
+	KingAttackersScale [8]int `json:"king_attackers_scale"`
+
+	//Pawn shield in front of the King (one or two ranks ahead), and penalty for the files near the King
+	//without own pawn (semi-open) or without any pawn (extra penalty)
+	PawnShieldClose  int `json:"pawn_shield_close"`
+	PawnShieldFar    int `json:"pawn_shield_far"`
+	KingSemiOpenFile int `json:"king_semi_open_file"`
+	KingOpenFile     int `json:"king_open_file"`
+
+	//The pawn structure score depend on the parameters, so each set of parameters has its own pawn hash table
+	pawnTable *PawnTable
+}
+
+// Default evaluation parameters, used by every Chess without its own parameters
+var default_params = DefaultEvalParams()
+
+// Return a new copy of the built-in evaluation parameters
+func DefaultEvalParams() *EvalParams {
+	return &EvalParams{
+		MaterialMG: [6]int{100, 500, 320, 330, 900, 20000},
+		MaterialEG: [6]int{120, 530, 300, 330, 950, 20000},
+
+		//Middlegame tables from https://www.chessprogramming.org/Simplified_Evaluation_Function
+		PieceSquareMG: [6][64]int{
+			{ // Pawn
+				0, 0, 0, 0, 0, 0, 0, 0,
+				50, 50, 50, 50, 50, 50, 50, 50,
+				10, 10, 20, 30, 30, 20, 10, 10,
+				5, 5, 10, 25, 25, 10, 5, 5,
+				0, 0, 0, 20, 20, 0, 0, 0,
+				5, -5, -10, 0, 0, -10, -5, 5,
+				5, 10, 10, -20, -20, 10, 10, 5,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{ // Rook
+				0, 0, 0, 0, 0, 0, 0, 0,
+				5, 10, 10, 10, 10, 10, 10, 5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				0, 0, 0, 5, 5, 0, 0, 0,
+			},
+			{ // Knight
+				-50, -40, -30, -30, -30, -30, -40, -50,
+				-40, -20, 0, 0, 0, 0, -20, -40,
+				-30, 0, 10, 15, 15, 10, 0, -30,
+				-30, 5, 15, 20, 20, 15, 5, -30,
+				-30, 0, 15, 20, 20, 15, 0, -30,
+				-30, 5, 10, 15, 15, 10, 5, -30,
+				-40, -20, 0, 5, 5, 0, -20, -40,
+				-50, -40, -30, -30, -30, -30, -40, -50,
+			},
+			{ // Bishop
+				-20, -10, -10, -10, -10, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 10, 10, 5, 0, -10,
+				-10, 5, 5, 10, 10, 5, 5, -10,
+				-10, 0, 10, 10, 10, 10, 0, -10,
+				-10, 10, 10, 10, 10, 10, 10, -10,
+				-10, 5, 0, 0, 0, 0, 5, -10,
+				-20, -10, -10, -10, -10, -10, -10, -20,
+			},
+			{ // Queen
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				0, 0, 5, 5, 5, 5, 0, -5,
+				-10, 5, 5, 5, 5, 5, 0, -10,
+				-10, 0, 5, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+			{ // King
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-30, -40, -40, -50, -50, -40, -40, -30,
+				-20, -30, -30, -40, -40, -30, -30, -20,
+				-10, -20, -20, -20, -20, -20, -20, -10,
+				20, 20, 0, 0, 0, 0, 20, 20,
+				20, 30, 10, 0, 0, 10, 30, 20,
+			},
+		},
+
+		//In the endgame, pawns are worth more the closer they are to promotion and the king should come to the center
+		//instead of hiding in the corner. Other pieces keep their middlegame value
+		PieceSquareEG: [6][64]int{
+			{ // Pawn
+				0, 0, 0, 0, 0, 0, 0, 0,
+				80, 80, 80, 80, 80, 80, 80, 80,
+				50, 50, 50, 50, 50, 50, 50, 50,
+				30, 30, 30, 30, 30, 30, 30, 30,
+				15, 15, 15, 15, 15, 15, 15, 15,
+				5, 5, 5, 5, 5, 5, 5, 5,
+				0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{ // Rook
+				0, 0, 0, 0, 0, 0, 0, 0,
+				5, 10, 10, 10, 10, 10, 10, 5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				-5, 0, 0, 0, 0, 0, 0, -5,
+				0, 0, 0, 5, 5, 0, 0, 0,
+			},
+			{ // Knight
+				-50, -40, -30, -30, -30, -30, -40, -50,
+				-40, -20, 0, 0, 0, 0, -20, -40,
+				-30, 0, 10, 15, 15, 10, 0, -30,
+				-30, 5, 15, 20, 20, 15, 5, -30,
+				-30, 0, 15, 20, 20, 15, 0, -30,
+				-30, 5, 10, 15, 15, 10, 5, -30,
+				-40, -20, 0, 5, 5, 0, -20, -40,
+				-50, -40, -30, -30, -30, -30, -40, -50,
+			},
+			{ // Bishop
+				-20, -10, -10, -10, -10, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 10, 10, 5, 0, -10,
+				-10, 5, 5, 10, 10, 5, 5, -10,
+				-10, 0, 10, 10, 10, 10, 0, -10,
+				-10, 10, 10, 10, 10, 10, 10, -10,
+				-10, 5, 0, 0, 0, 0, 5, -10,
+				-20, -10, -10, -10, -10, -10, -10, -20,
+			},
+			{ // Queen
+				-20, -10, -10, -5, -5, -10, -10, -20,
+				-10, 0, 0, 0, 0, 0, 0, -10,
+				-10, 0, 5, 5, 5, 5, 0, -10,
+				-5, 0, 5, 5, 5, 5, 0, -5,
+				0, 0, 5, 5, 5, 5, 0, -5,
+				-10, 5, 5, 5, 5, 5, 0, -10,
+				-10, 0, 5, 0, 0, 0, 0, -10,
+				-20, -10, -10, -5, -5, -10, -10, -20,
+			},
+			{ // King
+				-50, -40, -30, -20, -20, -30, -40, -50,
+				-30, -20, -10, 0, 0, -10, -20, -30,
+				-30, -10, 20, 30, 30, 20, -10, -30,
+				-30, -10, 30, 40, 40, 30, -10, -30,
+				-30, -10, 30, 40, 40, 30, -10, -30,
+				-30, -10, 20, 30, 30, 20, -10, -30,
+				-30, -30, 0, 0, 0, 0, -30, -30,
+				-50, -30, -30, -30, -30, -30, -30, -50,
+			},
+		},
+
+		PhaseWeight: [6]int{0, 2, 1, 1, 4, 0},
+
+		BishopPair: 66,
+		KnightPair: -64,
+		RookPair:   -100,
+		QueenPair:  -180,
+		NoPawn:     -300,
+
+		DoubledPawnMG:   -10,
+		DoubledPawnEG:   -20,
+		IsolatedPawnMG:  -10,
+		IsolatedPawnEG:  -15,
+		BackwardPawnMG:  -8,
+		BackwardPawnEG:  -10,
+		ConnectedPawnMG: [8]int{0, 0, 5, 8, 12, 20, 35, 0},
+		ConnectedPawnEG: [8]int{0, 0, 3, 5, 10, 15, 25, 0},
+		PassedPawnMG:    [8]int{0, 5, 10, 15, 25, 40, 60, 0},
+		PassedPawnEG:    [8]int{0, 10, 15, 25, 45, 70, 110, 0},
+		PassedPawnFree:  [8]int{0, 0, 5, 10, 20, 35, 60, 0},
+
+		PassedPawnEnemyKing: 5,
+		PassedPawnOwnKing:   2,
+
+		MobilityMG:      [6]int{0, 2, 4, 5, 1, 0},
+		MobilityEG:      [6]int{0, 4, 4, 5, 2, 0},
+		MobilityAverage: [6]int{0, 7, 4, 6, 13, 0},
+
+		KingAttackWeight:   [6]int{0, 40, 20, 20, 80, 0},
+		KingAttackersScale: [8]int{0, 0, 50, 75, 88, 94, 97, 99},
+
+		PawnShieldClose:  10,
+		PawnShieldFar:    5,
+		KingSemiOpenFile: -15,
+		KingOpenFile:     -10,
+
+		pawnTable: NewPawnTable(DEFAULT_PAWN_TABLE_SIZE),
+	}
+}
+
+// Load evaluation parameters from a JSON file. The parameters missing from the file keep their default value
+func LoadEvalParams(path string) (*EvalParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	params := DefaultEvalParams()
+	if err := json.Unmarshal(data, params); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// Save the evaluation parameters to a JSON file
+func (params *EvalParams) Save(path string) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Return a copy of the parameters, with its own (empty) pawn hash table
+func (params *EvalParams) Clone() *EvalParams {
+	clone := *params
+	clone.pawnTable = NewPawnTable(DEFAULT_PAWN_TABLE_SIZE)
+	return &clone
+}
+
+// Clear the cached pawn structure scores. It must be called after a pawn structure parameter is changed
+func (params *EvalParams) ClearCache() {
+	if params.pawnTable != nil {
+		params.pawnTable.Clear()
+	}
+}
+
+// Return the evaluation parameters of the position
+func (chess *Chess) EvalParams() *EvalParams {
+	if chess.Params == nil {
+		return default_params
+	}
+	return chess.Params
+}
+
+// Stop caching the pawn structure scores. Used when the parameters change between evaluations (like in the tuner)
+func (params *EvalParams) DisableCache() {
+	params.pawnTable = nil
+}
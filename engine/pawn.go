@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"math/bits"
+	"sync"
+)
+
+/*
+ * Pawn structure evaluation. The pawn structure change rarely during the search, so the terms that only depend
+ * on the pawns (doubled, isolated, backward, connected and passed pawns) are cached in a pawn hash table keyed by
+ * a hash of the pawns only. The passed pawn terms that depend on the other pieces (free path, king distance)
+ * are calculated on every evaluation from the passed pawns stored in the entry.
+ * Everything is calculated from White perspective, for Black we flip the pawn bitboards and reuse White logic
+ */
+
+// Default number of entries of the pawn hash table
+const DEFAULT_PAWN_TABLE_SIZE = 1 << 14
+
+type PawnEntry struct {
+	Key    uint64
+	MG, EG int       // Score of the pawn structure from White perspective
+	Passed [2]uint64 // Passed pawns of White and Black
+}
+
+// Pawn hash table. Unlike the transposition table, it's shared by every evaluation with the same parameters,
+// so it's guarded by a mutex
+type PawnTable struct {
+	entries []PawnEntry
+	mutex   sync.Mutex
+}
+
+func NewPawnTable(size int) *PawnTable {
+	if size < 1 {
+		size = 1
+	}
+	return &PawnTable{
+		entries: make([]PawnEntry, size),
+	}
+}
+
+// Return the entry of the pawn structure with the given pawn hash, if the table has it
+func (pt *PawnTable) Probe(key uint64) (PawnEntry, bool) {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+
+	entry := pt.entries[key%uint64(len(pt.entries))]
+	return entry, entry.Key == key
+}
+
+func (pt *PawnTable) Store(entry PawnEntry) {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+
+	pt.entries[entry.Key%uint64(len(pt.entries))] = entry
+}
+
+func (pt *PawnTable) Clear() {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+
+	clear(pt.entries)
+}
+
+// Return the Zobrist hash of the pawns only
+func (chess *Chess) PawnHash() uint64 {
+	var hash uint64
+	for _, piece := range []int{WHITE_PAWN, BLACK_PAWN} {
+		board := chess.Boards[piece]
+		for board != 0 {
+			index := bits.TrailingZeros64(board)
+			hash ^= zobristPiece[piece][index]
+			ClearBit(index, &board)
+		}
+	}
+	return hash
+}
+
+// Evaluate the pawn structure, from White perspective
+func (chess *Chess) EvaluatePawns() (int, int) {
+	e := evaluation{params: chess.EvalParams()}
+	chess.evaluatePawns(&e)
+	return e.mg, e.eg
+}
+
+func (chess *Chess) evaluatePawns(e *evaluation) {
+	var (
+		white, black = chess.Boards[WHITE_PAWN], chess.Boards[BLACK_PAWN]
+		passed       [2]uint64
+	)
+
+	//The trace need every term, so the pawn hash table is only used by the normal evaluation
+	if e.trace != nil || e.params.pawnTable == nil {
+		passed[0] = pawnStructure(white, black, WHITE, e)
+		passed[1] = FlipVertical(pawnStructure(FlipVertical(black), FlipVertical(white), BLACK, e))
+	} else {
+		entry := chess.pawnEntry(e.params)
+		e.mg += entry.MG
+		e.eg += entry.EG
+		passed = entry.Passed
+	}
+
+	//Passed pawn terms that depend on the other pieces. A missing King (the Horde, or an exploded King of Atomic) is -1
+	var (
+		occupied             = chess.GenerateAllWhites() | chess.GenerateAllBlacks()
+		whiteKing, blackKing = -1, -1
+		flippedWhiteKing     = -1
+		flippedBlackKing     = -1
+	)
+	if chess.Boards[WHITE_KING] != 0 {
+		whiteKing = bits.TrailingZeros64(chess.Boards[WHITE_KING])
+		flippedWhiteKing = FlipIndexVertical(whiteKing)
+	}
+	if chess.Boards[BLACK_KING] != 0 {
+		blackKing = bits.TrailingZeros64(chess.Boards[BLACK_KING])
+		flippedBlackKing = FlipIndexVertical(blackKing)
+	}
+	passedPawnExtra(passed[0], occupied, whiteKing, blackKing, WHITE, e)
+	passedPawnExtra(FlipVertical(passed[1]), FlipVertical(occupied), flippedBlackKing, flippedWhiteKing, BLACK, e)
+}
+
+// Return the cached pawn structure of the position, calculating it if the pawn hash table doesn't have it
+func (chess *Chess) pawnEntry(params *EvalParams) PawnEntry {
+	key := chess.PawnHash()
+	if entry, ok := params.pawnTable.Probe(key); ok {
+		return entry
+	}
+
+	var (
+		white, black = chess.Boards[WHITE_PAWN], chess.Boards[BLACK_PAWN]
+		e            = evaluation{params: params}
+	)
+	whitePassed := pawnStructure(white, black, WHITE, &e)
+	blackPassed := pawnStructure(FlipVertical(black), FlipVertical(white), BLACK, &e)
+
+	entry := PawnEntry{
+		Key:    key,
+		MG:     e.mg,
+		EG:     e.eg,
+		Passed: [2]uint64{whitePassed, FlipVertical(blackPassed)},
+	}
+	params.pawnTable.Store(entry)
+
+	return entry
+}
+
+// Score the pawn structure of own pawns (moving up the board) against enemy pawns, and return the passed pawns
+func pawnStructure(own, enemy uint64, side int, e *evaluation) uint64 {
+	var (
+		passed      uint64
+		enemyAttack = ((enemy >> 9) & ^FILE_MASK[0]) | ((enemy >> 7) & ^FILE_MASK[7])
+		ownAttack   = ((own << 9) & ^FILE_MASK[7]) | ((own << 7) & ^FILE_MASK[0])
+	)
+
+	//Doubled pawns
+	for _, file := range FILE_MASK {
+		if count := bits.OnesCount64(own & file); count > 1 {
+			e.add("doubled pawns", side, (count-1)*e.params.DoubledPawnMG, (count-1)*e.params.DoubledPawnEG)
+		}
+	}
+
+	board := own
+	for board != 0 {
+		index := bits.TrailingZeros64(board)
+		ClearBit(index, &board)
+
+		rank := index / 8
+		file := FILE_MASK[7-index%8]
+		adjacent := adjacentFiles(index)
+		front := forwardSquares(index)
+
+		//Isolated pawn, or backward pawn: no friendly pawn beside or behind it on the adjacent files,
+		//and the square in front of it is attacked by an enemy pawn
+		if own&adjacent == 0 {
+			e.add("isolated pawns", side, e.params.IsolatedPawnMG, e.params.IsolatedPawnEG)
+		} else if own&adjacent&^forwardRanks(rank) == 0 && IsPieceAtIndex(enemyAttack, index+8) {
+			e.add("backward pawns", side, e.params.BackwardPawnMG, e.params.BackwardPawnEG)
+		}
+
+		//Connected pawn: defended by a friendly pawn, or standing next to one
+		if IsPieceAtIndex(ownAttack, index) || own&adjacent&RANK_MASK[rank] != 0 {
+			e.add("connected pawns", side, e.params.ConnectedPawnMG[rank], e.params.ConnectedPawnEG[rank])
+		}
+
+		//Passed pawn: no enemy pawn in front of it on the same and adjacent files, and not blocked by an own pawn
+		if enemy&(front|(adjacent&forwardRanks(rank))) == 0 && own&file&front == 0 {
+			e.add("passed pawns", side, e.params.PassedPawnMG[rank], e.params.PassedPawnEG[rank])
+			SetBit(index, &passed)
+		}
+	}
+
+	return passed
+}
+
+// Endgame bonus for the passed pawns of the side moving up the board, depending on the other pieces and the Kings.
+// The distance to a missing King (-1) is not scored
+func passedPawnExtra(passed, occupied uint64, ownKing, enemyKing, side int, e *evaluation) {
+	for passed != 0 {
+		index := bits.TrailingZeros64(passed)
+		ClearBit(index, &passed)
+
+		rank := index / 8
+		if forwardSquares(index)&occupied == 0 {
+			e.add("passed pawn free path", side, 0, e.params.PassedPawnFree[rank])
+		}
+
+		//The pawn is not on the last rank, so there is always a square in front of it
+		stop := index + 8
+		weight := rank - 1
+		distance := 0
+		if enemyKing != -1 {
+			distance += e.params.PassedPawnEnemyKing * Distance(enemyKing, stop)
+		}
+		if ownKing != -1 {
+			distance -= e.params.PassedPawnOwnKing * Distance(ownKing, stop)
+		}
+		e.add("passed pawn king distance", side, 0, weight*distance)
+	}
+}
+
+// Squares in front of the square at index, on the same file
+func forwardSquares(index int) uint64 {
+	return FILE_MASK[7-index%8] & forwardRanks(index/8)
+}
+
+// All the ranks above the rank
+func forwardRanks(rank int) uint64 {
+	if rank >= 7 {
+		return 0
+	}
+	return ^uint64(0) << (8 * (rank + 1))
+}
+
+// Files next to the file of the square at index
+func adjacentFiles(index int) uint64 {
+	var (
+		file = 7 - index%8
+		res  uint64
+	)
+	if file > 0 {
+		res |= FILE_MASK[file-1]
+	}
+	if file < 7 {
+		res |= FILE_MASK[file+1]
+	}
+	return res
+}
+
+// King distance (number of King moves) between 2 squares
+func Distance(index1, index2 int) int {
+	return Max(Abs(index1/8-index2/8), Abs(index1%8-index2%8))
+}
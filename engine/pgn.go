@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// A game read from a PGN file
+type PGNGame struct {
+	Tags   map[string]string
+	FEN    string // Starting position, empty for the standard one
+	Moves  []Move
+	Result string // 1-0, 0-1, 1/2-1/2 or *
+}
+
+// Read the games of a PGN file. Comments, variations, NAGs and move numbers are skipped. A game with an illegal
+// or unknown move keeps the moves before it, and a game with a malformed FEN tag is skipped
+func ReadPGN(r io.Reader) ([]PGNGame, error) {
+	var (
+		games     []PGNGame
+		tags      = map[string]string{}
+		movetext  strings.Builder
+		scanner   = bufio.NewScanner(r)
+		inComment = false
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	finish := func() {
+		if len(tags) > 0 || strings.TrimSpace(movetext.String()) != "" {
+			if ValidateFEN(STANDARD, tags["FEN"]) == nil {
+				games = append(games, newPGNGame(tags, movetext.String()))
+			}
+		}
+		tags = map[string]string{}
+		movetext.Reset()
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		//A tag after the movetext start a new game
+		if !inComment && strings.HasPrefix(line, "[") {
+			if strings.TrimSpace(movetext.String()) != "" {
+				finish()
+			}
+			if name, value, ok := parsePGNTag(line); ok {
+				tags[name] = value
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "%") {
+			continue // Escaped line
+		}
+
+		//Remove the rest of line comments, and keep track of the brace comments that span several lines
+		for i := 0; i < len(line); i++ {
+			switch {
+			case inComment:
+				if line[i] == '}' {
+					inComment = false
+				}
+			case line[i] == '{':
+				inComment = true
+			case line[i] == ';':
+				i = len(line)
+			default:
+				movetext.WriteByte(line[i])
+			}
+		}
+		movetext.WriteByte(' ')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+
+	return games, nil
+}
+
+// Parse a tag pair: [Name "Value"]
+func parsePGNTag(line string) (string, string, bool) {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+	name, value, found := strings.Cut(line, " ")
+	if !found {
+		return "", "", false
+	}
+	value = strings.Trim(strings.TrimSpace(value), "\"")
+	return name, strings.ReplaceAll(value, "\\\"", "\""), true
+}
+
+// Play the movetext (without comments) from the starting position of the tags
+func newPGNGame(tags map[string]string, movetext string) PGNGame {
+	game := PGNGame{Tags: tags, FEN: tags["FEN"], Result: tags["Result"]}
+	if game.Result == "" {
+		game.Result = "*"
+	}
+
+	chess := NewChess()
+	chess.FEN(game.FEN)
+
+	//Replace the variations by spaces, they can be nested
+	var (
+		mainline strings.Builder
+		depth    = 0
+	)
+	for _, c := range movetext {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth = max(depth-1, 0)
+		case depth == 0:
+			mainline.WriteRune(c)
+		}
+	}
+
+	for _, token := range strings.Fields(mainline.String()) {
+		switch token {
+		case "1-0", "0-1", "1/2-1/2", "*":
+			game.Result = token
+			return game
+		}
+
+		//Skip the move numbers (12. or 12...), which can be glued to the move (12.e4), and the NAGs ($1)
+		if number := strings.TrimLeft(token, "0123456789"); number != token && strings.HasPrefix(number, ".") {
+			token = strings.TrimLeft(number, ".")
+		}
+		if token == "" || strings.HasPrefix(token, "$") {
+			continue
+		}
+
+		move, err := chess.ParseSAN(token)
+		if err != nil {
+			break
+		}
+		chess.MakeMove(move)
+		game.Moves = append(game.Moves, move)
+	}
+
+	return game
+}
@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// A game with a malformed FEN tag is skipped, the other games are read
+func TestReadPGNInvalidFEN(t *testing.T) {
+	pgn := `[Event "Bad"]
+[FEN "8/8/8/8/8/8/8/8"]
+
+1. e4 *
+
+[Event "Short"]
+[FEN "8/8/8"]
+
+*
+
+[Event "Good"]
+[FEN "4k3/8/8/8/8/8/8/4K2R w K - 0 1"]
+
+1. O-O Kd7 1-0
+`
+	games, err := ReadPGN(strings.NewReader(pgn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 || games[0].Tags["Event"] != "Good" {
+		t.Fatalf("ReadPGN() = %d games, want only the game with a valid FEN", len(games))
+	}
+	if len(games[0].Moves) != 2 || games[0].Result != "1-0" {
+		t.Errorf("ReadPGN() = %d moves, result %s, want 2 moves and 1-0", len(games[0].Moves), games[0].Result)
+	}
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"sort"
+)
+
+/*
+ * Quiescence search: at the end of the normal search, the position can be in the middle of an exchange, so its
+ * static evaluation is not reliable. Here only captures and promotions are searched until the position is quiet.
+ * The side to move can always stop capturing (stand pat), so the static evaluation is a lower bound of the score
+ */
+
+// Return the quiescence score of the position, from the side to move perspective
+func (chess *Chess) Quiescence(alpha, beta int) int {
+	if chess.IsVariantEnd() {
+		return -MATE // Lost by the rules of the variant
+	}
+
+	standPat := chess.Evaluate()
+	if chess.SideToMove == BLACK {
+		standPat = -standPat
+	}
+	if standPat >= beta {
+		return standPat
+	}
+	alpha = Max(alpha, standPat)
+
+	for _, move := range chess.orderCaptures(chess.MoveGeneration()) {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		score := -clone.Quiescence(-beta, -alpha)
+		if score >= beta {
+			return score
+		}
+		alpha = Max(alpha, score)
+	}
+
+	return alpha
+}
+
+// Keep only the captures and promotions, ordered by Most Valuable Victim - Least Valuable Attacker
+// (the most valuable captured piece first, and for the same victim the least valuable attacker first)
+func (chess *Chess) orderCaptures(moves []Move) []Move {
+	var (
+		captures []Move
+		values   []int
+		material = chess.EvalParams().MaterialMG
+	)
+
+	for _, move := range moves {
+		if !chess.IsCapture(move) && move.FromBoard == move.ToBoard {
+			continue
+		}
+
+		//The victim of en passant is a pawn, and a promotion without capture has no victim
+		value := 0
+		if chess.IsCapture(move) {
+			value = material[WHITE_PAWN]
+			for i := WHITE_PAWN; i < WHITE_KING; i++ {
+				if IsPieceAtIndex(chess.Boards[i]|chess.Boards[i+6], move.ToIndex) {
+					value = material[i]
+				}
+			}
+		}
+		value = value*10 - material[move.FromBoard%6]/100
+		value += material[move.ToBoard%6] - material[move.FromBoard%6] //Promotion
+
+		captures = append(captures, move)
+		values = append(values, value)
+	}
+
+	sort.Sort(byValue{captures, values})
+	return captures
+}
+
+type byValue struct {
+	moves  []Move
+	values []int
+}
+
+func (b byValue) Len() int           { return len(b.moves) }
+func (b byValue) Less(i, j int) bool { return b.values[i] > b.values[j] }
+func (b byValue) Swap(i, j int) {
+	b.moves[i], b.moves[j] = b.moves[j], b.moves[i]
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+}
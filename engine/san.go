@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Piece letter used by SAN, indexed by board mod 6 (pawn has no letter)
+var sanPieceLetter = [6]string{"", "R", "N", "B", "Q", "K"}
+
+// Convert a legal move of the current position to Standard Algebraic Notation (Nf3, exd5, e8=Q+, O-O-O#, N@f3)
+func (chess *Chess) SAN(move Move) string {
+	var str string
+
+	switch move.Castling {
+	case WHITE_KING_SIDE, BLACK_KING_SIDE:
+		str = "O-O"
+	case WHITE_QUEEN_SIDE, BLACK_QUEEN_SIDE:
+		str = "O-O-O"
+	default:
+		var (
+			piece   = move.FromBoard % 6
+			to      = FromIndexToAlgebraic(move.ToIndex)
+			from    = FromIndexToAlgebraic(move.FromIndex)
+			capture = IsPieceAtIndex(chess.GenerateAllWhites()|chess.GenerateAllBlacks(), move.ToIndex) ||
+				(piece == WHITE_PAWN && move.ToIndex == chess.EnPassantTarget)
+		)
+
+		if move.Drop {
+			str = move.String()
+		} else if piece == WHITE_PAWN {
+			//Pawn captures are written with the departure file
+			if capture {
+				str = from[:1] + "x"
+			}
+			str += to
+			if move.ToBoard != move.FromBoard {
+				str += "=" + sanPieceLetter[move.ToBoard%6]
+			}
+		} else {
+			//Disambiguate between pieces of the same type that can reach the same square
+			var sameFile, sameRank, ambiguous bool
+			for _, other := range chess.MoveGeneration() {
+				if other.Castling != 0 || other.Drop || other.FromBoard != move.FromBoard || other.ToIndex != move.ToIndex || other.FromIndex == move.FromIndex {
+					continue
+				}
+				ambiguous = true
+				sameFile = sameFile || IsAtSameFile(other.FromIndex, move.FromIndex)
+				sameRank = sameRank || IsAtSameRank(other.FromIndex, move.FromIndex)
+			}
+
+			str = sanPieceLetter[piece]
+			switch {
+			case !ambiguous:
+			case !sameFile:
+				str += from[:1]
+			case !sameRank:
+				str += from[1:]
+			default:
+				str += from
+			}
+			if capture {
+				str += "x"
+			}
+			str += to
+		}
+	}
+
+	//Add check and checkmate suffix
+	clone := chess.Clone()
+	clone.MakeMove(move)
+	if clone.IsWhiteKingChecked() || clone.IsBlackKingChecked() {
+		if len(clone.MoveGeneration()) == 0 {
+			str += "#"
+		} else {
+			str += "+"
+		}
+	}
+
+	return str
+}
+
+// Find the legal move matching the SAN string in the current position. Check/mate suffixes, annotations and
+// the promotion '=' are optional, and castling can also be written with zeros (0-0)
+func (chess *Chess) ParseSAN(str string) (Move, error) {
+	normalize := func(san string) string {
+		san = strings.TrimRight(strings.TrimSpace(san), "+#!?")
+		san = strings.ReplaceAll(san, "=", "")
+		return strings.ReplaceAll(san, "0", "O")
+	}
+
+	target := normalize(str)
+	for _, move := range chess.MoveGeneration() {
+		if normalize(chess.SAN(move)) == target {
+			return move, nil
+		}
+	}
+
+	return Move{}, fmt.Errorf("illegal or malformed move '%s'", str)
+}
+
+// Find the legal move matching the string in any notation we support: UCI (e2e4, e7e8q, e1h1 for a Chess960
+// castling), the notation used by NewMove and Move.String (e7e8Q, O-O, o-o-o) and SAN (Nf3, exd5, O-O)
+func (chess *Chess) ParseMove(str string) (Move, error) {
+	str = strings.TrimSpace(str)
+	if move, err := chess.ParseUCIMove(str); err == nil {
+		return move, nil
+	}
+
+	lower := strings.ToLower(str)
+	for _, move := range chess.MoveGeneration() {
+		if strings.ToLower(move.String()) == lower {
+			return move, nil
+		}
+	}
+
+	return chess.ParseSAN(str)
+}
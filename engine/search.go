@@ -4,42 +4,74 @@ import (
 	"math"
 )
 
+// Score of a checkmate. A mate found n plies from the root scores MATE - n (and a mated side -MATE + n),
+// so the shortest mate has the best score
+const (
+	MATE         = math.MaxInt32
+	MAX_MATE_PLY = 1000 // Scores within this many plies of MATE are mate scores
+)
+
+// Line is one ranked result of a root search: the root move, its score and the principal variation starting with it
+type Line struct {
+	Move  Move
+	Score int
+	PV    []Move
+}
+
+// Return true if the score is a mate score, for either side
+func IsMateScore(score int) bool {
+	return score > MATE-MAX_MATE_PLY || score < -MATE+MAX_MATE_PLY
+}
+
+// Fixed depth search of the current position with the given root window. It runs the same search as SearchJob
 func (chess *Chess) Search(depth, alpha, beta int) (int, Move) {
-	if depth == 0 {
-		return chess.Evaluate(), Move{} // Return evaluation and no move at leaf nodes
+	if depth <= 0 {
+		// Return evaluation and no move at leaf nodes. Evaluate is from White perspective, negamax need side to move perspective
+		if chess.SideToMove == BLACK {
+			return -chess.Evaluate(), Move{}
+		}
+		return chess.Evaluate(), Move{}
+	}
+
+	job := NewSearchJob(chess, SearchLimits{Depth: depth}, nil)
+	moves := job.rootMoves()
+	if len(moves) == 0 {
+		score, _ := job.search(job.chess, depth, 0, alpha, beta) // Checkmate or stalemate
+		return score, Move{}
 	}
 
-	moves := chess.MoveGeneration()
+	score, pv := job.searchMoves(job.chess, moves, depth, 0, alpha, beta)
+	return score, pv[0]
+}
+
+// MultiPV search: return the best n lines of the current position, ranked from best to worst.
+// Each pass search the root with a full window, excluding the root moves already found by previous passes
+func (chess *Chess) MultiPV(depth, n int) []Line {
+	return NewSearchJob(chess, SearchLimits{Depth: Max(depth, 1), MultiPV: n}, nil).Run(nil)
+}
 
-	// Check for game end (checkmate or stalemate)
+// Search only the given root moves and return the exact score of each one, ranked from best to worst.
+// Every move is searched with a full window, so the scores can be compared to each other ("how good is this move?")
+func (chess *Chess) SearchRootMoves(depth int, moves []Move) []Line {
 	if len(moves) == 0 {
-		if chess.IsBlackKingChecked() || chess.IsWhiteKingChecked() {
-			// Checkmate: Large negative score (loss for side to move)
-			return -math.MaxInt32, Move{}
-		}
-		return 0, Move{} // Stalemate
+		return nil
 	}
+	limits := SearchLimits{Depth: Max(depth, 1), MultiPV: len(moves), RootMoves: moves}
+	return NewSearchJob(chess, limits, nil).Run(nil)
+}
 
-	// Perform minimax with alpha-beta pruning (fail-soft)
-	bestScore := -math.MaxInt32
-	var bestMove Move
-	for _, move := range moves {
-		clone := chess.Clone()
-		clone.MakeMove(move)
-		// Recursive search with negated alpha/beta
-		eval, _ := clone.Search(depth-1, -beta, -alpha)
-		eval = -eval // Negate for negamax
-		if eval > bestScore {
-			bestScore = eval
-			bestMove = move
-			if eval > alpha {
-				alpha = eval // Update alpha only when a new best move is found
-			}
+// Parse a list of moves (any notation supported by ParseMove) into legal root moves of the current position.
+// A move given twice is only kept once
+func (chess *Chess) ParseRootMoves(strs []string) ([]Move, error) {
+	var moves []Move
+	for _, str := range strs {
+		move, err := chess.ParseMove(str)
+		if err != nil {
+			return nil, err
 		}
-		if eval >= beta {
-			return bestScore, bestMove // Fail-soft beta cutoff
+		if !containsMove(moves, move) {
+			moves = append(moves, move)
 		}
 	}
-
-	return bestScore, bestMove
+	return moves, nil
 }
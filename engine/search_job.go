@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Maximum depth of an iterative deepening search without depth limit (infinite analysis, pondering)
+const MAX_DEPTH = 64
+
+// Limits of an iterative deepening search
+type SearchLimits struct {
+	Depth     int           // Maximum depth, 0 means MAX_DEPTH
+	MoveTime  time.Duration // Time allowed for the search, 0 means no time limit (until stopped)
+	MultiPV   int           // Number of lines to search, 0 means 1
+	RootMoves []Move        // Only search these root moves (go searchmoves), empty means all legal moves
+	Mate      int           // Look for a mate in this many moves first (go mate), 0 means no mate search
+}
+
+// Information about a finished iteration, reported to the caller of Run
+type SearchInfo struct {
+	Depth  int
+	Nodes  int
+	TBHits int // Number of tablebase probes
+	Time   time.Duration
+	Lines  []Line
+}
+
+// One iterative deepening search. The job is created by NewSearchJob, executed by Run on one goroutine and can be
+// controlled from other goroutines with Stop and SetDeadline (for example, when a ponder search become a timed search).
+// The transposition table is shared by the jobs of the same game, so a search reuse the results of the previous ones
+type SearchJob struct {
+	chess    *Chess
+	limits   SearchLimits
+	tt       *TranspositionTable
+	stopped  atomic.Bool
+	deadline atomic.Int64 // Unix nano, 0 means no deadline
+	nodes    int
+	tbHits   int
+	depth    int // Depth of the current iteration
+	start    time.Time
+}
+
+func NewSearchJob(chess *Chess, limits SearchLimits, tt *TranspositionTable) *SearchJob {
+	if limits.Depth <= 0 || limits.Depth > MAX_DEPTH {
+		limits.Depth = MAX_DEPTH
+	}
+	if limits.MultiPV <= 0 {
+		limits.MultiPV = 1
+	}
+	if tt == nil {
+		tt = NewTranspositionTable(DEFAULT_TT_SIZE)
+	}
+
+	job := &SearchJob{
+		chess:  chess.Clone(),
+		limits: limits,
+		tt:     tt,
+		start:  time.Now(),
+	}
+	if limits.MoveTime > 0 {
+		job.SetDeadline(job.start.Add(limits.MoveTime))
+	}
+
+	return job
+}
+
+// Stop the search as soon as possible. Run return the lines of the last finished iteration
+func (job *SearchJob) Stop() {
+	job.stopped.Store(true)
+}
+
+// Set the time at which the search stop. A zero time remove the deadline
+func (job *SearchJob) SetDeadline(deadline time.Time) {
+	if deadline.IsZero() {
+		job.deadline.Store(0)
+	} else {
+		job.deadline.Store(deadline.UnixNano())
+	}
+}
+
+// Return the expected reply to the line's move (the move to ponder on): the second move of the PV, or
+// the transposition table move of the position after the line's move when the PV is too short
+func (job *SearchJob) PonderMove(line Line) (Move, bool) {
+	if len(line.PV) >= 2 {
+		return line.PV[1], true
+	}
+
+	clone := job.chess.Clone()
+	clone.MakeMove(line.Move)
+	if entry, found := job.tt.Probe(clone.Hash()); found && containsMove(clone.MoveGeneration(), entry.Move) {
+		return entry.Move, true
+	}
+
+	return Move{}, false
+}
+
+// Run the iterative deepening search and return the ranked lines of the deepest finished iteration.
+// The first iteration is always finished, so there is a move to play as long as the position has one.
+// info (can be nil) is called after each finished iteration
+func (job *SearchJob) Run(info func(SearchInfo)) []Line {
+	var lines []Line
+	job.start = time.Now()
+
+	moves := job.rootMoves()
+	if len(moves) == 0 {
+		return nil
+	}
+
+	//Mate search first, among the same root moves: if the mate is proven, there is no need for the normal search.
+	//Otherwise we still need a move to play, so we fall back to the normal search
+	if job.limits.Mate > 0 {
+		if line, found := job.MateSearch(job.limits.Mate, moves, info); found {
+			return []Line{{Move: line[0], Score: MATE - len(line), PV: line}}
+		}
+	}
+
+	for depth := 1; depth <= job.limits.Depth; depth++ {
+		//Search the best lines first, so the previous iteration's results speed up this one
+		ordered := make([]Move, 0, len(moves))
+		for _, line := range lines {
+			ordered = append(ordered, line.Move)
+		}
+		for _, move := range moves {
+			if !containsMove(ordered, move) {
+				ordered = append(ordered, move)
+			}
+		}
+
+		job.depth = depth
+		iteration := job.searchRoot(ordered, depth)
+		if job.aborted() {
+			break // Discard the unfinished iteration
+		}
+		lines = iteration
+
+		if info != nil {
+			info(SearchInfo{Depth: depth, Nodes: job.nodes, TBHits: job.tbHits, Time: time.Since(job.start), Lines: lines})
+		}
+		if job.stopped.Load() {
+			break
+		}
+	}
+
+	return lines
+}
+
+// Root moves of the search: the given ones, or all the legal moves. In the tablebases, only the moves that keep the
+// best result are searched, unless several lines are asked: then every move is ranked, so none is filtered
+func (job *SearchJob) rootMoves() []Move {
+	moves := job.limits.RootMoves
+	if len(moves) == 0 {
+		moves = job.chess.MoveGeneration()
+	}
+
+	if tb := job.chess.Tablebase; tb != nil && job.limits.MultiPV == 1 && len(moves) > 0 {
+		if filtered, ok := tb.FilterRootMoves(job.chess, moves); ok && len(filtered) > 0 {
+			job.tbHits += len(moves)
+			moves = filtered
+		}
+	}
+
+	return moves
+}
+
+// Search the root with MultiPV passes, each one excluding the root moves found by the previous passes
+func (job *SearchJob) searchRoot(moves []Move, depth int) []Line {
+	var lines []Line
+	moves = append([]Move{}, moves...)
+
+	for len(lines) < job.limits.MultiPV && len(moves) > 0 {
+		score, pv := job.searchMoves(job.chess, moves, depth, 0, -MATE, MATE)
+		if job.aborted() {
+			return lines
+		}
+		lines = append(lines, Line{Move: pv[0], Score: score, PV: pv})
+
+		for i, move := range moves {
+			if move == pv[0] {
+				moves = append(moves[:i], moves[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return lines
+}
+
+// Negamax search with alpha-beta pruning (fail-soft) and transposition table. ply is the distance from the root,
+// used to score the mates so the shortest one is preferred
+func (job *SearchJob) search(chess *Chess, depth, ply, alpha, beta int) (int, []Move) {
+	job.countNode()
+	if job.aborted() {
+		return 0, nil
+	}
+
+	//A game won by the rules of the variant is lost for the side to move, like a checkmate
+	if chess.IsVariantEnd() {
+		return -MATE + ply, nil
+	}
+
+	//Positions drawn by the rules are not searched. A checkmate comes first: a mate given on the last move before
+	//the fifty-move rule still wins
+	if chess.IsSearchDraw() {
+		if chess.IsChecked() && len(chess.MoveGeneration()) == 0 {
+			return -MATE + ply, nil
+		}
+		return 0, nil
+	}
+
+	//The result of a tablebase position is known
+	if score, ok := chess.probeTablebase(); ok {
+		job.tbHits++
+		return score, nil
+	}
+
+	if depth == 0 {
+		// Evaluate is from White perspective, negamax need side to move perspective
+		if chess.SideToMove == BLACK {
+			return -chess.Evaluate(), nil
+		}
+		return chess.Evaluate(), nil
+	}
+
+	//Probe the transposition table
+	key := chess.Hash()
+	entry, found := job.tt.Probe(key)
+	if found && entry.Depth >= depth {
+		score := scoreFromTT(entry.Score, ply)
+		switch {
+		case entry.Flag == TT_EXACT:
+			return score, job.ttPV(chess, depth)
+		case entry.Flag == TT_LOWER_BOUND && score >= beta:
+			return score, nil
+		case entry.Flag == TT_UPPER_BOUND && score <= alpha:
+			return score, nil
+		}
+	}
+
+	moves := chess.MoveGeneration()
+
+	// Check for game end (checkmate or stalemate)
+	if len(moves) == 0 {
+		if chess.IsChecked() {
+			return -MATE + ply, nil
+		}
+		return 0, nil
+	}
+
+	//Search the transposition table move first
+	if found {
+		for i, move := range moves {
+			if move == entry.Move {
+				moves[0], moves[i] = moves[i], moves[0]
+				break
+			}
+		}
+	}
+
+	bestScore, bestPV := job.searchMoves(chess, moves, depth, ply, alpha, beta)
+	if job.aborted() {
+		return 0, nil
+	}
+
+	//Store the result
+	flag := TT_EXACT
+	switch {
+	case bestScore <= alpha:
+		flag = TT_UPPER_BOUND
+	case bestScore >= beta:
+		flag = TT_LOWER_BOUND
+	}
+	job.tt.Store(key, depth, scoreToTT(bestScore, ply), flag, bestPV[0])
+
+	return bestScore, bestPV
+}
+
+// Search the given moves of a position, at the root or inside the tree, and return the best score with its line
+func (job *SearchJob) searchMoves(chess *Chess, moves []Move, depth, ply, alpha, beta int) (int, []Move) {
+	//Start below the mate score so we always have a move
+	bestScore := -MATE - 1
+	var bestPV []Move
+	for _, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		eval, pv := job.search(clone, depth-1, ply+1, -beta, -alpha)
+		eval = -eval
+		if job.aborted() {
+			return 0, nil
+		}
+		if eval > bestScore {
+			bestScore = eval
+			bestPV = append([]Move{move}, pv...)
+			if eval > alpha {
+				alpha = eval // Update alpha only when a new best move is found
+			}
+		}
+		if eval >= beta {
+			break // Fail-soft beta cutoff
+		}
+	}
+
+	return bestScore, bestPV
+}
+
+// Principal variation of an exact transposition table hit: follow the exact entries from the position while their
+// moves are legal, up to the depth of the hit
+func (job *SearchJob) ttPV(chess *Chess, depth int) []Move {
+	var pv []Move
+	for len(pv) < depth {
+		entry, found := job.tt.Probe(chess.Hash())
+		if !found || entry.Flag != TT_EXACT || !containsMove(chess.MoveGeneration(), entry.Move) {
+			break
+		}
+		pv = append(pv, entry.Move)
+		chess = chess.Clone()
+		chess.MakeMove(entry.Move)
+	}
+	return pv
+}
+
+// Count a node and check the deadline every 2048 nodes
+func (job *SearchJob) countNode() {
+	job.nodes++
+	if job.nodes&2047 == 0 {
+		if deadline := job.deadline.Load(); deadline != 0 && time.Now().UnixNano() >= deadline {
+			job.stopped.Store(true)
+		}
+	}
+}
+
+// The search is aborted when it is stopped, except during the first iteration which always finish
+func (job *SearchJob) aborted() bool {
+	return job.depth > 1 && job.stopped.Load()
+}
+
+func containsMove(moves []Move, move Move) bool {
+	for _, m := range moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package engine
+
+import "testing"
+
+func TestSearchPrefersShortestMate(t *testing.T) {
+	chess := NewChess()
+	chess.FEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+
+	//Longer mates are found at this depth too, the mate in 1 must score better
+	score, move := chess.Search(5, -MATE, MATE)
+	if score != MATE-1 || move.UCI() != "a1a8" {
+		t.Errorf("Search() = %d %s, want %d a1a8", score, move.UCI(), MATE-1)
+	}
+}
+
+func TestSearchMateScore(t *testing.T) {
+	tests := []struct {
+		fen   string
+		depth int
+		score int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 3, MATE - 1}, // Ra8#
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 5, MATE - 1},     // Rh8#
+		{"7k/7p/5K1P/8/8/8/8/R7 b - - 0 1", 3, -MATE + 2},  // Kg8 Ra8#
+		{"7k/7p/5K1P/8/8/8/8/R7 b - - 0 1", 5, -MATE + 2},  // Same, from the transposition table
+		{"k7/8/2K5/8/8/8/8/6R1 w - - 0 1", 4, MATE - 3},    // Kb6 Kb8 Rg8#
+	}
+
+	for _, test := range tests {
+		chess := NewChess()
+		chess.FEN(test.fen)
+		lines := NewSearchJob(chess, SearchLimits{Depth: test.depth}, nil).Run(nil)
+		if len(lines) == 0 || lines[0].Score != test.score {
+			t.Errorf("%s depth %d: got %v, want score %d", test.fen, test.depth, lines, test.score)
+		}
+	}
+}
+
+func TestSearchPVLength(t *testing.T) {
+	chess := NewChess()
+	chess.FEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+
+	//The iterations reuse the transposition table, whose hits must not cut the PV short
+	job := NewSearchJob(chess, SearchLimits{Depth: 4, MultiPV: 3}, nil)
+	job.Run(func(info SearchInfo) {
+		for _, line := range info.Lines {
+			if len(line.PV) != info.Depth {
+				t.Errorf("depth %d: PV %v has %d moves", info.Depth, line.PV, len(line.PV))
+			}
+		}
+	})
+}
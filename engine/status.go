@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"math/bits"
+)
+
+// Status of a game
+type GameStatus int
+
+const (
+	ONGOING GameStatus = iota
+	CHECKMATE
+	STALEMATE
+	FIFTY_MOVE
+	REPETITION
+	INSUFFICIENT_MATERIAL
+	TIMEOUT
+	RESIGNATION
+	VARIANT_END // Won by the rules of the variant (King of the Hill, Three-check, Horde)
+)
+
+func (status GameStatus) String() string {
+	switch status {
+	case CHECKMATE:
+		return "checkmate"
+	case STALEMATE:
+		return "stalemate"
+	case FIFTY_MOVE:
+		return "fifty-move"
+	case REPETITION:
+		return "repetition"
+	case INSUFFICIENT_MATERIAL:
+		return "insufficient-material"
+	case TIMEOUT:
+		return "timeout"
+	case RESIGNATION:
+		return "resignation"
+	case VARIANT_END:
+		return "variant-end"
+	default:
+		return "ongoing"
+	}
+}
+
+// Result of a game: how it ended and who won (WHITE, BLACK, or 0 for a draw or an ongoing game)
+type Result struct {
+	Status GameStatus
+	Winner int
+}
+
+// Format the result the PGN way: 1-0, 0-1, 1/2-1/2, or * for an ongoing game
+func (result Result) String() string {
+	switch {
+	case result.Status == ONGOING:
+		return "*"
+	case result.Winner == WHITE:
+		return "1-0"
+	case result.Winner == BLACK:
+		return "0-1"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+func (result Result) IsOver() bool {
+	return result.Status != ONGOING
+}
+
+// Return the status of the game from the current position. Timeout and resignation can't be seen on the board,
+// see Resign and Timeout for those
+func (chess *Chess) Status() GameStatus {
+	if chess.IsVariantEnd() {
+		return VARIANT_END
+	}
+	hasMoves := len(chess.MoveGeneration()) > 0
+
+	switch {
+	case !hasMoves && chess.IsChecked():
+		return CHECKMATE //Checkmate take precedence over the fifty-move rule
+	case !hasMoves:
+		return STALEMATE
+	case chess.IsInsufficientMaterial():
+		return INSUFFICIENT_MATERIAL
+	case chess.IsFiftyMoveRule():
+		return FIFTY_MOVE
+	case chess.IsRepetition(3):
+		return REPETITION
+	default:
+		return ONGOING
+	}
+}
+
+// Return the result of the game from the current position. On checkmate, the side to move lose
+func (chess *Chess) Result() Result {
+	status := chess.Status()
+	switch status {
+	case CHECKMATE:
+		return Result{Status: status, Winner: WHITE + BLACK - chess.SideToMove}
+	case VARIANT_END:
+		winner, _ := chess.VariantWinner()
+		return Result{Status: status, Winner: winner}
+	}
+	return Result{Status: status}
+}
+
+// Result of a game where side resign
+func Resign(side int) Result {
+	return Result{Status: RESIGNATION, Winner: WHITE + BLACK - side}
+}
+
+// Result of a game where side run out of time. It's a draw if the opponent can't checkmate by any sequence of moves
+func (chess *Chess) Timeout(side int) Result {
+	opponent := WHITE + BLACK - side
+	if !chess.HasMatingMaterial(opponent) {
+		return Result{Status: TIMEOUT}
+	}
+	return Result{Status: TIMEOUT, Winner: opponent}
+}
+
+// Check if side has enough material to checkmate with the help of the opponent: anything more than a lone King
+// or a King with a single minor piece. A single minor piece can only mate if the opponent has pieces to block its own King
+func (chess *Chess) HasMatingMaterial(side int) bool {
+	own, opponent := 0, 6
+	if side == BLACK {
+		own, opponent = 6, 0
+	}
+
+	if chess.Boards[WHITE_PAWN+own]|chess.Boards[WHITE_ROOK+own]|chess.Boards[WHITE_QUEEN+own] != 0 {
+		return true
+	}
+	switch bits.OnesCount64(chess.Boards[WHITE_KNIGHT+own] | chess.Boards[WHITE_BISHOP+own]) {
+	case 0:
+		return false
+	case 1:
+		for i := WHITE_PAWN; i < WHITE_KING; i++ {
+			if chess.Boards[i+opponent] != 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,884 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * Syzygy tablebases (https://syzygy-tables.info): the exact result of every position with few pieces, read from the
+ * .rtbw (WDL: win/draw/loss) and .rtbz (DTZ: distance to the next capture or pawn move) files of a local directory.
+ * The file format is the one of Ronald de Man's generator, this reader follow the probing code of Stockfish:
+ * - A file is named by its material ("KRPvKR"), and store the positions of both colors: the position is flipped
+ *   when Black has the material of the first part of the name
+ * - A position is encoded to an index: the board is mirrored so the leading piece (or pawn) is in a small part of
+ *   the board, then each group of identical pieces is encoded with binomial coefficients
+ * - The values are compressed with recursive pairing (a pair of symbols become a new symbol) and the symbols are
+ *   stored with a canonical Huffman code in fixed size blocks. A sparse index give the block of an index
+ * Tables are only read from the disk the first time they are probed. See syzygy_probe.go for the probing of a position
+ */
+
+const TB_MAX_PIECES = 7
+
+// Flags of a table
+const (
+	TB_FLAG_STM          = 1
+	TB_FLAG_MAPPED       = 2
+	TB_FLAG_WIN_PLIES    = 4
+	TB_FLAG_LOSS_PLIES   = 8
+	TB_FLAG_WIDE         = 16
+	TB_FLAG_SINGLE_VALUE = 128
+)
+
+var (
+	tb_wdl_magic = [4]byte{0x71, 0xE8, 0x23, 0x5D}
+	tb_dtz_magic = [4]byte{0xD7, 0x66, 0x0C, 0xA5}
+)
+
+// Syzygy piece codes of the boards (pawn, knight, bishop, rook, queen, king are 1 to 6, +8 for Black)
+var tb_piece_codes = [12]int{1, 4, 2, 3, 5, 6, 9, 12, 10, 11, 13, 14}
+
+// Encoding tables, the squares are numbered the Syzygy way (a1 = 0, b1 = 1, ..., h8 = 63)
+var (
+	tb_map_b1h1h7     [64]int     // Squares below the a1-h8 diagonal to 0..27
+	tb_map_a1d1d4     [64]int     // Squares of the a1-d1-d4 triangle to 0..9
+	tb_map_kk         [10][64]int // The 462 legal positions of 2 Kings, with the first King in the a1-d1-d4 triangle
+	tb_binomial       [7][64]uint64
+	tb_map_pawns      [64]int
+	tb_lead_pawn_idx  [6][64]uint64
+	tb_lead_pawn_size [6][4]uint64
+)
+
+func init() {
+	code := 0
+	for s := range 64 {
+		if tbOffDiagonal(s) < 0 {
+			tb_map_b1h1h7[s] = code
+			code++
+		}
+	}
+
+	//The squares on the a1-d4 diagonal come last
+	var diagonal []int
+	code = 0
+	for s := 0; s <= 27; s++ {
+		if tbOffDiagonal(s) < 0 && s&7 <= 3 {
+			tb_map_a1d1d4[s] = code
+			code++
+		} else if tbOffDiagonal(s) == 0 && s&7 <= 3 {
+			diagonal = append(diagonal, s)
+		}
+	}
+	for _, s := range diagonal {
+		tb_map_a1d1d4[s] = code
+		code++
+	}
+
+	//If the first King is on the diagonal, the second one must not be above it. Both Kings on the diagonal come last
+	var bothOnDiagonal [][2]int
+	code = 0
+	for idx := range 10 {
+		for s1 := 0; s1 <= 27; s1++ {
+			if tb_map_a1d1d4[s1] != idx || (idx == 0 && s1 != 1) {
+				continue
+			}
+			for s2 := range 64 {
+				switch {
+				case Distance(s1, s2) <= 1:
+					//Illegal position
+				case tbOffDiagonal(s1) == 0 && tbOffDiagonal(s2) > 0:
+					//First on the diagonal, second above
+				case tbOffDiagonal(s1) == 0 && tbOffDiagonal(s2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{idx, s2})
+				default:
+					tb_map_kk[idx][s2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, p := range bothOnDiagonal {
+		tb_map_kk[p[0]][p[1]] = code
+		code++
+	}
+
+	//Binomial[k][n]: number of ways to choose k elements from n
+	tb_binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 7 && k <= n; k++ {
+			if k > 0 {
+				tb_binomial[k][n] += tb_binomial[k-1][n-1]
+			}
+			if k < n {
+				tb_binomial[k][n] += tb_binomial[k][n-1]
+			}
+		}
+	}
+
+	//The leading pawn is the one with the highest MapPawns value: the closest to the edge, then the lowest rank.
+	//The index of the leading pawns restart at each file, because the tables are split by file
+	available := 47
+	for leadPawns := 1; leadPawns <= 5; leadPawns++ {
+		for f := range 4 {
+			idx := uint64(0)
+			for r := 1; r <= 6; r++ {
+				s := r*8 + f
+				if leadPawns == 1 {
+					tb_map_pawns[s] = available
+					available--
+					tb_map_pawns[s^7] = available
+					available--
+				}
+				tb_lead_pawn_idx[leadPawns][s] = idx
+				idx += tb_binomial[leadPawns-1][tb_map_pawns[s]]
+			}
+			tb_lead_pawn_size[leadPawns][f] = idx
+		}
+	}
+}
+
+// Rank minus file of a Syzygy square: negative below the a1-h8 diagonal, 0 on it
+func tbOffDiagonal(s int) int {
+	return s>>3 - s&7
+}
+
+// Decoding data of one side and one file of a table
+type tbPairs struct {
+	flags           int
+	pieces          [TB_MAX_PIECES]int
+	groupLen        [TB_MAX_PIECES + 1]int
+	groupIdx        [TB_MAX_PIECES + 1]uint64
+	sizeofBlock     uint64
+	span            uint64
+	blocksNum       int
+	blockLengthSize int
+	sparseIndexSize int
+	maxSymLen       int
+	minSymLen       int // The value itself for a single value table
+	base64          []uint64
+	symlen          []int
+	mapIdx          [4]int // DTZ value maps
+
+	//Offsets in the file
+	lowestSym, btree, sparseIndex, blockLength, data int
+}
+
+type tbTable struct {
+	name            string // White pieces first, like "KRvK"
+	path            string
+	dtz             bool
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	symmetric       bool
+	pawnCount       [2]int // Leading color first
+
+	once  sync.Once
+	err   error
+	data  []byte
+	items [2][4]tbPairs // By side (2 for non symmetric WDL tables, otherwise 1) and file (4 with pawns, otherwise 1)
+}
+
+// Syzygy tablebases of a set of directories
+type Tablebase struct {
+	wdl, dtz  map[string]*tbTable // By material signature, in both color orders
+	MaxPieces int
+	Files     int
+	mutex     sync.Mutex
+	errors    []error // Files that could not be read and were not reported yet (see Errors)
+}
+
+// Find the tablebase files in the directories (separated like in PATH). The files are only read when probed
+func LoadTablebase(paths string) (*Tablebase, error) {
+	tb := &Tablebase{wdl: map[string]*tbTable{}, dtz: map[string]*tbTable{}}
+
+	for _, dir := range filepath.SplitList(paths) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".rtbw" && ext != ".rtbz") {
+				continue
+			}
+			table, err := newTBTable(strings.TrimSuffix(entry.Name(), ext), filepath.Join(dir, entry.Name()), ext == ".rtbz")
+			if err != nil {
+				continue // Not a tablebase file
+			}
+
+			tables := tb.wdl
+			if table.dtz {
+				tables = tb.dtz
+			}
+			white, black, _ := strings.Cut(table.name, "v")
+			tables[table.name] = table
+			tables[black+"v"+white] = table
+			tb.Files++
+			if !table.dtz {
+				tb.MaxPieces = max(tb.MaxPieces, table.pieceCount)
+			}
+		}
+	}
+
+	if tb.Files == 0 {
+		return nil, fmt.Errorf("no Syzygy tablebase files in '%s'", paths)
+	}
+	return tb, nil
+}
+
+func newTBTable(name, path string, dtz bool) (*tbTable, error) {
+	white, black, found := strings.Cut(name, "v")
+	if !found || !strings.HasPrefix(white, "K") || !strings.HasPrefix(black, "K") || len(white)+len(black) > TB_MAX_PIECES ||
+		strings.Trim(white+black, "KQRBNP") != "" {
+		return nil, fmt.Errorf("invalid table name '%s'", name)
+	}
+
+	table := &tbTable{
+		name:       name,
+		path:       path,
+		dtz:        dtz,
+		pieceCount: len(white) + len(black),
+		symmetric:  white == black,
+	}
+	for _, part := range []string{white, black} {
+		for _, piece := range "QRBNP" {
+			if strings.Count(part, string(piece)) == 1 {
+				table.hasUniquePieces = true
+			}
+		}
+	}
+
+	//The leading color is the side with less pawns (but some pawns), for a better compression
+	whitePawns, blackPawns := strings.Count(white, "P"), strings.Count(black, "P")
+	table.hasPawns = whitePawns+blackPawns > 0
+	if blackPawns == 0 || (whitePawns > 0 && blackPawns >= whitePawns) {
+		table.pawnCount = [2]int{whitePawns, blackPawns}
+	} else {
+		table.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+
+	return table, nil
+}
+
+// Read the table the first time it is used. Return false if the file is missing or invalid, the error is kept
+// for the caller (see Errors)
+func (tb *Tablebase) load(table *tbTable) bool {
+	table.once.Do(func() {
+		table.err = table.read()
+		if table.err != nil {
+			tb.mutex.Lock()
+			tb.errors = append(tb.errors, fmt.Errorf("cannot read tablebase file %s: %w", table.path, table.err))
+			tb.mutex.Unlock()
+		}
+	})
+	return table.err == nil
+}
+
+// Return the errors of the files that could not be read since the last call. The probes of these files fail, and
+// the search go on without them
+func (tb *Tablebase) Errors() []error {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+	errors := tb.errors
+	tb.errors = nil
+	return errors
+}
+
+func (table *tbTable) read() (err error) {
+	data, err := os.ReadFile(table.path)
+	if err != nil {
+		return err
+	}
+	magic := tb_wdl_magic
+	if table.dtz {
+		magic = tb_dtz_magic
+	}
+	if len(data) < 5 || [4]byte(data[:4]) != magic {
+		return errors.New("not a Syzygy tablebase file")
+	}
+	table.data = data
+
+	//A truncated file make the offsets go out of the data
+	defer func() {
+		if recover() != nil {
+			err = errors.New("corrupted tablebase file")
+		}
+	}()
+
+	var (
+		pos     = 4
+		sides   = 1
+		maxFile = 0
+		pp      = table.hasPawns && table.pawnCount[1] > 0 // Pawns on both sides
+	)
+	if data[pos]&2 != 0 != table.hasPawns {
+		return errors.New("the pieces don't match the file name")
+	}
+	pos++
+	if !table.dtz && !table.symmetric {
+		sides = 2
+	}
+	if table.hasPawns {
+		maxFile = 3
+	}
+
+	//Order of the groups and sequence of the pieces
+	for f := 0; f <= maxFile; f++ {
+		order := [2][2]int{{int(data[pos] & 0xF), 0xF}, {int(data[pos] >> 4), 0xF}}
+		if pp {
+			order[0][1], order[1][1] = int(data[pos+1]&0xF), int(data[pos+1]>>4)
+			pos++
+		}
+		pos++
+
+		for k := range table.pieceCount {
+			for i := range sides {
+				if i == 0 {
+					table.items[i][f].pieces[k] = int(data[pos] & 0xF)
+				} else {
+					table.items[i][f].pieces[k] = int(data[pos] >> 4)
+				}
+			}
+			pos++
+		}
+		for i := range sides {
+			table.setGroups(&table.items[i][f], order[i], f)
+		}
+	}
+	pos += pos & 1
+
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			pos = table.setSizes(&table.items[i][f], pos)
+		}
+	}
+	if table.dtz {
+		pos = table.setDTZMap(pos, maxFile)
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			table.items[i][f].sparseIndex = pos
+			pos += table.items[i][f].sparseIndexSize * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			table.items[i][f].blockLength = pos
+			pos += table.items[i][f].blockLengthSize * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := range sides {
+			d := &table.items[i][f]
+			pos = (pos + 0x3F) &^ 0x3F
+			d.data = pos
+			pos += d.blocksNum * int(d.sizeofBlock)
+			if d.blocksNum > 0 && pos > len(data) {
+				return errors.New("truncated tablebase file")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Split the pieces into groups of identical pieces, and calculate the multiplier of each group in the index.
+// The first group is the leading pieces (the 2 Kings, or 3 unique pieces) or the leading pawns
+func (table *tbTable) setGroups(d *tbPairs, order [2]int, f int) {
+	var (
+		n        = 0
+		firstLen = 2
+	)
+	if table.hasPawns {
+		firstLen = 0
+	} else if table.hasUniquePieces {
+		firstLen = 3
+	}
+
+	d.groupLen[0] = 1
+	for i := 1; i < table.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	//The groups are not encoded in the order of the pieces: the order of the leading group and of the remaining pawns
+	//is stored in the file
+	var (
+		pp          = table.hasPawns && table.pawnCount[1] > 0
+		next        = 1
+		freeSquares = 64 - d.groupLen[0]
+		idx         = uint64(1)
+	)
+	if pp {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupIdx[0] = idx
+			switch {
+			case table.hasPawns:
+				idx *= tb_lead_pawn_size[d.groupLen[0]][f]
+			case table.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupIdx[1] = idx
+			idx *= tb_binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			d.groupIdx[next] = idx
+			idx *= tb_binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+// Read the compression data of one side and file
+func (table *tbTable) setSizes(d *tbPairs, pos int) int {
+	data := table.data
+	d.flags = int(data[pos])
+	pos++
+
+	if d.flags&TB_FLAG_SINGLE_VALUE != 0 {
+		d.minSymLen = int(data[pos])
+		return pos + 1
+	}
+
+	//The size of the table is the multiplier after the last group
+	size := uint64(0)
+	for i, length := range d.groupLen {
+		if length == 0 {
+			size = d.groupIdx[i]
+			break
+		}
+	}
+
+	d.sizeofBlock = 1 << data[pos]
+	d.span = 1 << data[pos+1]
+	d.sparseIndexSize = int((size + d.span - 1) / d.span)
+	padding := int(data[pos+2])
+	d.blocksNum = int(binary.LittleEndian.Uint32(data[pos+3:]))
+	d.blockLengthSize = d.blocksNum + padding
+	d.maxSymLen = int(data[pos+7])
+	d.minSymLen = int(data[pos+8])
+	d.lowestSym = pos + 9
+	pos += 9
+
+	//Canonical Huffman code: longer symbols have lower values. base64[i] is the lowest value of the symbols of
+	//length minSymLen + i, left aligned on 64 bits
+	count := d.maxSymLen - d.minSymLen + 1
+	d.base64 = make([]uint64, count)
+	for i := count - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(table.lowestSym(d, i)) - uint64(table.lowestSym(d, i+1))) / 2
+	}
+	for i := range count {
+		d.base64[i] <<= 64 - i - d.minSymLen
+	}
+	pos += count * 2
+
+	//Binary tree of the recursive pairing: each symbol is a value or a pair of symbols
+	symbols := int(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	d.btree = pos
+	d.symlen = make([]int, symbols)
+	visited := make([]bool, symbols)
+	for sym := range symbols {
+		if !visited[sym] {
+			d.symlen[sym] = table.setSymlen(d, sym, visited)
+		}
+	}
+
+	return pos + symbols*3 + symbols&1
+}
+
+// Number of values (minus one) a symbol expand to
+func (table *tbTable) setSymlen(d *tbPairs, sym int, visited []bool) int {
+	visited[sym] = true
+	right := table.right(d, sym)
+	if right == 0xFFF {
+		return 0
+	}
+
+	left := table.left(d, sym)
+	if !visited[left] {
+		d.symlen[left] = table.setSymlen(d, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = table.setSymlen(d, right, visited)
+	}
+
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// Read the maps from the stored DTZ values to the real values, for each WDL result
+func (table *tbTable) setDTZMap(pos, maxFile int) int {
+	data := table.data
+	for f := 0; f <= maxFile; f++ {
+		d := &table.items[0][f]
+		if d.flags&TB_FLAG_MAPPED == 0 {
+			continue
+		}
+		if d.flags&TB_FLAG_WIDE != 0 {
+			pos += pos & 1
+			for i := range 4 {
+				d.mapIdx[i] = pos + 2
+				pos += 2*int(binary.LittleEndian.Uint16(data[pos:])) + 2
+			}
+		} else {
+			for i := range 4 {
+				d.mapIdx[i] = pos + 1
+				pos += int(data[pos]) + 1
+			}
+		}
+	}
+
+	return pos + pos&1
+}
+
+func (table *tbTable) lowestSym(d *tbPairs, length int) int {
+	return int(binary.LittleEndian.Uint16(table.data[d.lowestSym+2*length:]))
+}
+
+// Left and right symbols of a pair (12 bits each). A value is stored as the left symbol, with 0xFFF on the right
+func (table *tbTable) left(d *tbPairs, sym int) int {
+	lr := table.data[d.btree+3*sym:]
+	return int(lr[1]&0xF)<<8 | int(lr[0])
+}
+
+func (table *tbTable) right(d *tbPairs, sym int) int {
+	lr := table.data[d.btree+3*sym:]
+	return int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// Data of the side and file. Symmetric tables and DTZ tables only have one side, pawnless tables one file
+func (table *tbTable) get(stm, f int) *tbPairs {
+	sides := 1
+	if !table.dtz && !table.symmetric {
+		sides = 2
+	}
+	if !table.hasPawns {
+		f = 0
+	}
+	return &table.items[stm%sides][f]
+}
+
+// Value stored at the index
+func (table *tbTable) decompress(d *tbPairs, idx uint64) int {
+	if d.flags&TB_FLAG_SINGLE_VALUE != 0 {
+		return d.minSymLen
+	}
+
+	//The sparse index give the block and the offset in the block of the value in the middle of each span,
+	//then we move to the block that contains idx (block n contains blockLength[n] + 1 values)
+	var (
+		data        = table.data
+		k           = int(idx / d.span)
+		block       = int(binary.LittleEndian.Uint32(data[d.sparseIndex+6*k:]))
+		offset      = int(binary.LittleEndian.Uint16(data[d.sparseIndex+6*k+4:]))
+		blockLength = func(block int) int {
+			return int(binary.LittleEndian.Uint16(data[d.blockLength+2*block:]))
+		}
+	)
+	offset += int(idx%d.span) - int(d.span/2)
+	for offset < 0 {
+		block--
+		offset += blockLength(block) + 1
+	}
+	for offset > blockLength(block) {
+		offset -= blockLength(block) + 1
+		block++
+	}
+
+	//Read the Huffman symbols of the block until the one that contains our value
+	var (
+		ptr     = d.data + block*int(d.sizeofBlock)
+		buf     = binary.BigEndian.Uint64(data[ptr:])
+		bufSize = 64
+		sym     int
+	)
+	ptr += 8
+	for {
+		length := 0
+		for buf < d.base64[length] {
+			length++
+		}
+		sym = int((buf-d.base64[length])>>(64-length-d.minSymLen)) + table.lowestSym(d, length)
+		if offset < d.symlen[sym]+1 {
+			break
+		}
+
+		offset -= d.symlen[sym] + 1
+		length += d.minSymLen
+		buf <<= length
+		bufSize -= length
+		if bufSize <= 32 {
+			bufSize += 32
+			if ptr+4 <= len(data) {
+				buf |= uint64(binary.BigEndian.Uint32(data[ptr:])) << (64 - bufSize)
+			}
+			ptr += 4
+		}
+	}
+
+	//Expand the symbol down to the value
+	for d.symlen[sym] != 0 {
+		left := table.left(d, sym)
+		if offset < d.symlen[left]+1 {
+			sym = left
+		} else {
+			offset -= d.symlen[left] + 1
+			sym = table.right(d, sym)
+		}
+	}
+
+	return table.left(d, sym)
+}
+
+// Convert the stored value to the WDL result, or to the DTZ in plies
+func (table *tbTable) mapScore(d *tbPairs, value, wdl int) int {
+	if !table.dtz {
+		return value - 2
+	}
+
+	//Index of the map by WDL result (loss, blessed loss, draw, cursed win, win)
+	wdlMap := [5]int{1, 3, 0, 2, 0}
+	if d.flags&TB_FLAG_MAPPED != 0 {
+		offset := d.mapIdx[wdlMap[wdl+2]]
+		if d.flags&TB_FLAG_WIDE != 0 {
+			value = int(binary.LittleEndian.Uint16(table.data[offset+2*value:]))
+		} else {
+			value = int(table.data[offset+value])
+		}
+	}
+
+	//The DTZ can be stored in moves instead of plies
+	if (wdl == WDL_WIN && d.flags&TB_FLAG_WIN_PLIES == 0) || (wdl == WDL_LOSS && d.flags&TB_FLAG_LOSS_PLIES == 0) ||
+		wdl == WDL_CURSED_WIN || wdl == WDL_BLESSED_LOSS {
+		value *= 2
+	}
+
+	return value + 1
+}
+
+// Probe the table of the position. The DTZ tables only store one side to move, TB_CHANGE_STM is returned for the other
+func (tb *Tablebase) probeTable(chess *Chess, dtz bool, wdl int) (int, int) {
+	var (
+		whites = chess.GenerateAllWhites()
+		blacks = chess.GenerateAllBlacks()
+	)
+	if bits.OnesCount64(whites|blacks) == 2 {
+		return WDL_DRAW, TB_OK // KvK
+	}
+
+	tables := tb.wdl
+	if dtz {
+		tables = tb.dtz
+	}
+	table := tables[chess.MaterialSignature()]
+	if table == nil || !tb.load(table) {
+		return 0, TB_FAIL
+	}
+
+	d, stm, idx := table.encode(chess)
+	if dtz && d.flags&TB_FLAG_STM != stm && !(table.symmetric && !table.hasPawns) {
+		return 0, TB_CHANGE_STM
+	}
+
+	return table.mapScore(d, table.decompress(d, idx), wdl), TB_OK
+}
+
+// Index of the position in the table, with the data of the side and file that store it and the side to move of the
+// table (0 for the side of the first part of the name)
+func (table *tbTable) encode(chess *Chess) (*tbPairs, int, uint64) {
+	//The table has the position with the colors swapped when Black has the first part of the name.
+	//Symmetric tables only store White to move
+	var (
+		flip                   = chess.MaterialSignature() != table.name || (table.symmetric && chess.SideToMove == BLACK)
+		flipColor, flipSquares = 0, 0
+		stm                    = 0
+	)
+	if chess.SideToMove == BLACK {
+		stm = 1
+	}
+	if flip {
+		flipColor, flipSquares, stm = 8, 56, stm^1
+	}
+
+	var (
+		squares, pieces [TB_MAX_PIECES]int
+		size            = 0
+		leadPawns       uint64
+		leadPawnsCount  = 0
+		tbFile          = 0
+	)
+
+	//The tables with pawns are split by the file of the leading pawn (a to d, after mirroring)
+	if table.hasPawns {
+		leadPawns = chess.Boards[WHITE_PAWN]
+		if (table.items[0][0].pieces[0]^flipColor)&8 != 0 {
+			leadPawns = chess.Boards[BLACK_PAWN]
+		}
+		for board := leadPawns; board != 0; board &= board - 1 {
+			squares[size] = tbSquare(bits.TrailingZeros64(board)) ^ flipSquares
+			size++
+		}
+		leadPawnsCount = size
+
+		lead := 0
+		for i := 1; i < leadPawnsCount; i++ {
+			if tb_map_pawns[squares[i]] > tb_map_pawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+		tbFile = min(squares[0]&7, 7-squares[0]&7)
+	}
+
+	for piece := WHITE_PAWN; piece <= BLACK_KING; piece++ {
+		board := chess.Boards[piece] &^ leadPawns
+		for ; board != 0; board &= board - 1 {
+			squares[size] = tbSquare(bits.TrailingZeros64(board)) ^ flipSquares
+			pieces[size] = tb_piece_codes[piece] ^ flipColor
+			size++
+		}
+	}
+
+	//Order the pieces like in the table
+	d := table.get(stm, tbFile)
+	for i := leadPawnsCount; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	//Mirror the board so the leading piece is on the a to d files
+	if squares[0]&7 > 3 {
+		for i := range size {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+	if table.hasPawns {
+		//Leading pawns, the others in ascending MapPawns order
+		idx = tb_lead_pawn_idx[leadPawnsCount][squares[0]]
+		others := squares[1:leadPawnsCount]
+		sort.SliceStable(others, func(i, j int) bool {
+			return tb_map_pawns[others[i]] < tb_map_pawns[others[j]]
+		})
+		for i := 1; i < leadPawnsCount; i++ {
+			idx += tb_binomial[i][tb_map_pawns[squares[i]]]
+		}
+	} else {
+		//Without pawns, mirror the board again so the leading piece is in the a1-d1-d4 triangle, then below the diagonal
+		if squares[0]>>3 > 3 {
+			for i := range size {
+				squares[i] ^= 56
+			}
+		}
+		for i := range d.groupLen[0] {
+			if tbOffDiagonal(squares[i]) == 0 {
+				continue
+			}
+			if tbOffDiagonal(squares[i]) > 0 {
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+
+		if table.hasUniquePieces {
+			idx = tbEncodeUnique(squares[0], squares[1], squares[2])
+		} else {
+			idx = uint64(tb_map_kk[tb_map_a1d1d4[squares[0]]][squares[1]])
+		}
+	}
+	idx *= d.groupIdx[0]
+
+	//Remaining groups, each one in ascending square order. A square is mapped down by the number of squares
+	//of the previous groups below it
+	var (
+		start          = d.groupLen[0]
+		remainingPawns = table.hasPawns && table.pawnCount[1] > 0
+	)
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+		n := uint64(0)
+		for i, s := range group {
+			adjust := 0
+			for _, previous := range squares[:start] {
+				if s > previous {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += tb_binomial[i+1][s-adjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+
+	return d, stm, idx
+}
+
+// Encode 3 unique leading pieces, the first one in the a1-d1-d4 triangle
+func tbEncodeUnique(s0, s1, s2 int) uint64 {
+	var (
+		adjust1 = 0
+		adjust2 = 0
+	)
+	if s1 > s0 {
+		adjust1++
+	}
+	if s2 > s0 {
+		adjust2++
+	}
+	if s2 > s1 {
+		adjust2++
+	}
+
+	switch {
+	case tbOffDiagonal(s0) != 0:
+		return uint64((tb_map_a1d1d4[s0]*63+s1-adjust1)*62 + s2 - adjust2)
+	case tbOffDiagonal(s1) != 0:
+		return uint64((6*63+(s0>>3)*28+tb_map_b1h1h7[s1])*62 + s2 - adjust2)
+	case tbOffDiagonal(s2) != 0:
+		return uint64(6*63*62 + 4*28*62 + (s0>>3)*7*28 + ((s1>>3)-adjust1)*28 + tb_map_b1h1h7[s2])
+	default:
+		return uint64(6*63*62 + 4*28*62 + 4*7*28 + (s0>>3)*7*6 + ((s1>>3)-adjust1)*6 + (s2 >> 3) - adjust2)
+	}
+}
+
+// Syzygy square of an index (a1 = 0, h8 = 63)
+func tbSquare(index int) int {
+	return index ^ 7
+}
@@ -0,0 +1,658 @@
+package engine
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/*
+ * Generator of the Syzygy tables of testdata/syzygy. The tables are solved by retrograde analysis with the move
+ * generation of the engine, then written in the Syzygy format with the encoding of the reader:
+ *   go test ./engine -run TestGenerateSyzygy -update-syzygy
+ * The values are compressed with a canonical Huffman code, and the runs of the most common value with pairs.
+ * syzygy_test.go check the tables against chess facts that don't depend on the generator: the KPK bitbase, the
+ * longest KQvK and KRvK mates, known positions
+ */
+
+var updateSyzygy = flag.Bool("update-syzygy", false, "regenerate the Syzygy tables of testdata/syzygy")
+
+// Values of a successor that is not in the table being solved (its WDL for the side to move, -1 - (wdl + 2))
+const tb_gen_external = -1
+
+type tbGenTable struct {
+	name   string
+	boards []int // Board of each piece, in the order of the table
+	hasDTZ bool  // Also write the DTZ table
+	table  *tbTable
+	files  int
+	sides  int
+	offset [2][4]int // First key of each side and file
+
+	//Solver data, by key. A key is an index of the table, after the offset of its side and file
+	rep    []int32   // Representative position of the key, -1 for none (an index of squares and blacks)
+	wdl    []int8    // WDL result for the side to move
+	dtz    []int32   // DTZ in plies (a mated side has 1)
+	mated  []bool    // Checkmated
+	first  []int32   // First successor of each representative
+	succ   []int32   // Successors: key<<1 | zeroing, or an external result
+	keys   []int     // Key of each representative
+	pos    [][4]int8 // Squares of the representative positions
+	blacks []bool    // Black to move in the representative position
+}
+
+func newTBGenTable(name string, boards []int, dtz bool) *tbGenTable {
+	table, err := newTBTable(name, "", false)
+	if err != nil {
+		panic(err)
+	}
+
+	gen := &tbGenTable{name: name, boards: boards, hasDTZ: dtz, table: table, files: 1, sides: 2}
+	if table.hasPawns {
+		gen.files = 4
+	}
+	if table.symmetric {
+		gen.sides = 1
+	}
+
+	size := 0
+	for f := range gen.files {
+		for i := range gen.sides {
+			d := &table.items[i][f]
+			for k, board := range boards {
+				d.pieces[k] = tb_piece_codes[board]
+			}
+			table.setGroups(d, [2]int{0, 0xF}, f)
+			gen.offset[i][f] = size
+			size += int(gen.size(d))
+		}
+	}
+
+	gen.rep = make([]int32, size)
+	for i := range gen.rep {
+		gen.rep[i] = -1
+	}
+	gen.wdl = make([]int8, size)
+	gen.dtz = make([]int32, size)
+	gen.mated = make([]bool, size)
+	return gen
+}
+
+// Number of indexes of a side and file, the multiplier after the last group
+func (gen *tbGenTable) size(d *tbPairs) uint64 {
+	for i, length := range d.groupLen {
+		if length == 0 {
+			return d.groupIdx[i]
+		}
+	}
+	return 0
+}
+
+func (gen *tbGenTable) key(chess *Chess) int {
+	d, stm, idx := gen.table.encode(chess)
+	for f := range gen.files {
+		if d == &gen.table.items[stm%gen.sides][f] {
+			return gen.offset[stm%gen.sides][f] + int(idx)
+		}
+	}
+	panic("unknown table data")
+}
+
+// Position of a representative
+func (gen *tbGenTable) position(r int) *Chess {
+	chess := NewChess()
+	for k, board := range gen.boards {
+		SetBit(int(gen.pos[r][k]), &chess.Boards[board])
+	}
+	if gen.blacks[r] {
+		chess.SideToMove = BLACK
+	}
+	chess.resetHash()
+	return chess
+}
+
+// Find a representative position of every key: every position is the same as one with the first piece in the a1-d1-d4
+// triangle (or the leading pawn on the a to d files), and a symmetric table only has White to move
+func (gen *tbGenTable) enumerate() {
+	var (
+		n       = len(gen.boards)
+		squares [4]int
+		sides   = []int{WHITE, BLACK}
+	)
+	if gen.table.symmetric {
+		sides = sides[:1]
+	}
+
+	var place func(k int, side int)
+	place = func(k int, side int) {
+		if k == n {
+			chess := NewChess()
+			for i, board := range gen.boards {
+				SetBit(squares[i], &chess.Boards[board])
+			}
+			chess.SideToMove = side
+			opponentChecked := chess.IsBlackKingChecked()
+			if side == BLACK {
+				opponentChecked = chess.IsWhiteKingChecked()
+			}
+			if opponentChecked {
+				return // Illegal position
+			}
+
+			key := gen.key(chess)
+			if gen.rep[key] < 0 {
+				gen.rep[key] = int32(len(gen.pos))
+				var pos [4]int8
+				for i := range n {
+					pos[i] = int8(squares[i])
+				}
+				gen.pos = append(gen.pos, pos)
+				gen.blacks = append(gen.blacks, side == BLACK)
+			}
+			return
+		}
+
+		for s := range 64 {
+			s7 := tbSquare(s)
+			switch {
+			case k == 0 && gen.table.hasPawns && s7&7 > 3:
+				continue
+			case k == 0 && !gen.table.hasPawns && (s7&7 > 3 || s7>>3 > s7&7):
+				continue
+			}
+			board := gen.boards[k]
+			if (board == WHITE_PAWN || board == BLACK_PAWN) && (s/8 == 0 || s/8 == 7) {
+				continue
+			}
+			used := false
+			for i := range k {
+				if squares[i] == s {
+					used = true
+				}
+			}
+			if used {
+				continue
+			}
+			squares[k] = s
+			place(k+1, side)
+		}
+	}
+
+	for _, side := range sides {
+		place(0, side)
+	}
+}
+
+// Generate the successors of every representative. The moves to another material are results of the solved tables
+func (gen *tbGenTable) successors(solved map[string]*tbGenTable) {
+	gen.first = make([]int32, len(gen.pos)+1)
+	gen.keys = make([]int, len(gen.pos))
+	for r := range gen.pos {
+		gen.first[r] = int32(len(gen.succ))
+		chess := gen.position(r)
+		gen.keys[r] = gen.key(chess)
+		moves := chess.MoveGeneration()
+		if len(moves) == 0 && chess.IsChecked() {
+			gen.mated[gen.keys[r]] = true
+		}
+
+		for _, move := range moves {
+			zeroing := chess.IsCapture(move) || move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN
+			clone := chess.Clone()
+			clone.MakeMove(move)
+
+			if table := tbGenLookup(solved, clone); table == gen {
+				key := gen.key(clone)
+				if gen.rep[key] < 0 {
+					panic(fmt.Sprintf("%s: no representative for %s", gen.name, clone.ToFEN()))
+				}
+				flag := int32(0)
+				if zeroing {
+					flag = 1
+				}
+				gen.succ = append(gen.succ, int32(key)<<1|flag)
+			} else if table != nil {
+				key := table.key(clone)
+				if table.rep[key] < 0 {
+					panic(fmt.Sprintf("%s: no representative for %s", table.name, clone.ToFEN()))
+				}
+				gen.succ = append(gen.succ, tb_gen_external-int32(table.wdl[key]+2))
+			} else {
+				gen.succ = append(gen.succ, tb_gen_external-WDL_DRAW-2) // A bare King, or a minor piece
+			}
+		}
+	}
+	gen.first[len(gen.pos)] = int32(len(gen.succ))
+}
+
+// Solved table of a position, in either color order
+func tbGenLookup(solved map[string]*tbGenTable, chess *Chess) *tbGenTable {
+	white, black, _ := strings.Cut(chess.MaterialSignature(), "v")
+	if table := solved[white+"v"+black]; table != nil {
+		return table
+	}
+	return solved[black+"v"+white]
+}
+
+// Result of a successor for its side to move, and if the move is zeroing
+func (gen *tbGenTable) successor(s int32) (int, int, bool) {
+	if s < 0 {
+		return -1, int(tb_gen_external-s) - 2, true
+	}
+	return int(s >> 1), int(gen.wdl[s>>1]), s&1 != 0
+}
+
+// Solve the WDL: a position is won if a move lead to a lost position, lost if all the moves lead to won positions.
+// The positions still unknown at the end are draws
+func (gen *tbGenTable) solveWDL() {
+	const unknown = 3
+	for r, key := range gen.keys {
+		gen.wdl[key] = unknown
+		if gen.first[r] == gen.first[r+1] {
+			gen.wdl[key] = WDL_DRAW // Stalemate
+			if gen.mated[key] {
+				gen.wdl[key] = WDL_LOSS
+			}
+		}
+	}
+
+	keys := gen.keys
+	for changed := true; changed; {
+		changed = false
+		for r, key := range keys {
+			if gen.wdl[key] != unknown {
+				continue
+			}
+			allWins := true
+			for _, s := range gen.succ[gen.first[r]:gen.first[r+1]] {
+				_, wdl, _ := gen.successor(s)
+				if wdl == WDL_LOSS {
+					gen.wdl[key] = WDL_WIN
+					changed = true
+					break
+				}
+				if wdl != WDL_WIN {
+					allWins = false
+				}
+			}
+			if gen.wdl[key] == unknown && allWins {
+				gen.wdl[key] = WDL_LOSS
+				changed = true
+			}
+		}
+	}
+	for _, key := range keys {
+		if gen.wdl[key] == unknown {
+			gen.wdl[key] = WDL_DRAW
+		}
+	}
+
+	//Solve the DTZ of the won and lost positions: a win take the fastest move to a loss, with 1 for a zeroing or mating
+	//move, a loss the slowest one
+	const infinite = 1 << 30
+	for _, key := range keys {
+		gen.dtz[key] = infinite
+	}
+	for changed := true; changed; {
+		changed = false
+		for r, key := range keys {
+			value := int32(infinite)
+			switch gen.wdl[key] {
+			case WDL_WIN:
+				for _, s := range gen.succ[gen.first[r]:gen.first[r+1]] {
+					next, wdl, zeroing := gen.successor(s)
+					switch {
+					case wdl != WDL_LOSS:
+					case zeroing || gen.mated[next]:
+						value = 1
+					default:
+						value = min(value, 1+gen.dtz[next])
+					}
+				}
+			case WDL_LOSS:
+				value = 1
+				for _, s := range gen.succ[gen.first[r]:gen.first[r+1]] {
+					next, _, zeroing := gen.successor(s)
+					if !zeroing {
+						value = max(value, 1+gen.dtz[next])
+					}
+				}
+			default:
+				continue
+			}
+			value = min(value, infinite)
+			if value != gen.dtz[key] {
+				gen.dtz[key] = value
+				changed = true
+			}
+		}
+	}
+}
+
+// Write the WDL table, and the DTZ table (White to move only) if the table has one
+func (gen *tbGenTable) write(dir string) error {
+	wdl := func(key int) int { return int(gen.wdl[key]) + 2 }
+	if err := gen.writeFile(filepath.Join(dir, gen.name+".rtbw"), false, gen.sides, 0, wdl); err != nil {
+		return err
+	}
+	if !gen.hasDTZ {
+		return nil
+	}
+	dtz := func(key int) int {
+		if gen.wdl[key] != WDL_WIN {
+			return -1 // Not stored
+		}
+		return int(gen.dtz[key]) - 1
+	}
+	return gen.writeFile(filepath.Join(dir, gen.name+".rtbz"), true, 1, TB_FLAG_WIN_PLIES|TB_FLAG_LOSS_PLIES, dtz)
+}
+
+func (gen *tbGenTable) writeFile(path string, dtz bool, sides, flags int, value func(key int) int) error {
+	var (
+		header []byte
+		items  []tbGenItem
+	)
+	magic := tb_wdl_magic
+	if dtz {
+		magic = tb_dtz_magic
+	}
+	header = append(header, magic[:]...)
+	tableFlags := byte(0)
+	if !dtz && !gen.table.symmetric {
+		tableFlags |= 1
+	}
+	if gen.table.hasPawns {
+		tableFlags |= 2
+	}
+	header = append(header, tableFlags)
+
+	for range gen.files {
+		header = append(header, 0) // The leading group first, for both sides
+		for _, board := range gen.boards {
+			code := byte(tb_piece_codes[board])
+			header = append(header, code|code<<4)
+		}
+	}
+	if len(header)&1 != 0 {
+		header = append(header, 0)
+	}
+
+	for f := range gen.files {
+		for i := range sides {
+			d := &gen.table.items[i][f]
+			values := make([]int, gen.size(d))
+			for idx := range values {
+				key := gen.offset[i][f] + idx
+				values[idx] = -1
+				if gen.rep[key] >= 0 {
+					values[idx] = value(key)
+				}
+			}
+			items = append(items, tbGenCompress(values, flags))
+		}
+	}
+
+	//Sizes, then the sparse indexes, the block lengths and the blocks of all the sides and files
+	data := header
+	for _, item := range items {
+		data = append(data, item.sizes...)
+	}
+	if dtz && len(data)&1 != 0 {
+		data = append(data, 0)
+	}
+	for _, item := range items {
+		data = append(data, item.sparseIndex...)
+	}
+	for _, item := range items {
+		data = append(data, item.blockLength...)
+	}
+	for _, item := range items {
+		for len(data)&0x3F != 0 {
+			data = append(data, 0)
+		}
+		data = append(data, item.blocks...)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+type tbGenItem struct {
+	sizes, sparseIndex, blockLength, blocks []byte
+}
+
+const (
+	TB_GEN_BLOCK_SIZE = 6    // 64 bytes
+	TB_GEN_SPAN       = 10   // 1024 values
+	TB_GEN_RUN        = 4096 // Symbol of a run of 2^j common values: TB_GEN_RUN + j, above the values
+	TB_GEN_MAX_RUN    = 12
+)
+
+// Compress the values of a side and file. The values not stored (-1) get the most common value
+func tbGenCompress(values []int, flags int) tbGenItem {
+	freq := map[int]int{}
+	for _, value := range values {
+		if value >= 0 {
+			freq[value]++
+		}
+	}
+	common, count := 0, -1
+	for value, n := range freq {
+		if n > count || (n == count && value < common) {
+			common, count = value, n
+		}
+	}
+	for i := range values {
+		if values[i] < 0 {
+			values[i] = common
+			freq[common]++
+		}
+	}
+
+	if len(freq) == 1 {
+		return tbGenItem{sizes: []byte{byte(flags | TB_FLAG_SINGLE_VALUE), byte(common)}}
+	}
+
+	//The runs of the common value are encoded with pairs: a run of 2^j values is a pair of two runs of 2^(j-1) values
+	type token struct{ symbol, count int }
+	var tokens []token
+	for i := 0; i < len(values); {
+		run := 0
+		for i+run < len(values) && values[i+run] == common {
+			run++
+		}
+		if run == 0 {
+			tokens = append(tokens, token{values[i], 1})
+			i++
+			continue
+		}
+		for run > 0 {
+			j := min(bits.Len(uint(run))-1, TB_GEN_MAX_RUN)
+			symbol := common
+			if j > 0 {
+				symbol = TB_GEN_RUN + j
+			}
+			tokens = append(tokens, token{symbol, 1 << j})
+			run -= 1 << j
+			i += 1 << j
+		}
+	}
+	freq = map[int]int{}
+	longest := 0
+	for _, token := range tokens {
+		freq[token.symbol]++
+		if token.symbol >= TB_GEN_RUN {
+			longest = max(longest, token.symbol-TB_GEN_RUN)
+		}
+	}
+	for j := range longest {
+		symbol := common
+		if j > 0 {
+			symbol = TB_GEN_RUN + j
+		}
+		freq[symbol] = max(freq[symbol], 1) // The runs are made of the shorter ones
+	}
+
+	//Canonical Huffman code: the symbols are numbered from the longest code to the shortest one
+	lengths := tbGenHuffman(freq)
+	symbols := make([]int, 0, len(freq))
+	for symbol := range freq {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if lengths[a] != lengths[b] {
+			return lengths[a] > lengths[b]
+		}
+		return a < b
+	})
+	minLen, maxLen := lengths[symbols[len(symbols)-1]], lengths[symbols[0]]
+	var (
+		lowest = make([]int, maxLen+2)
+		base   = make([]uint64, maxLen+2)
+		number = map[int]int{}
+		countL = make([]int, maxLen+2)
+	)
+	for n, symbol := range symbols {
+		number[symbol] = n
+		countL[lengths[symbol]]++
+	}
+	for l := maxLen - 1; l >= minLen; l-- {
+		lowest[l] = lowest[l+1] + countL[l+1]
+		base[l] = (base[l+1] + uint64(countL[l+1])) / 2
+	}
+
+	sizes := []byte{byte(flags), TB_GEN_BLOCK_SIZE, TB_GEN_SPAN, 0, 0, 0, 0, 0, byte(maxLen), byte(minLen)}
+	for l := minLen; l <= maxLen; l++ {
+		sizes = binary.LittleEndian.AppendUint16(sizes, uint16(lowest[l]))
+	}
+	sizes = binary.LittleEndian.AppendUint16(sizes, uint16(len(symbols)))
+	for _, symbol := range symbols {
+		left, right := symbol, 0xFFF // A value, with 0xFFF as right symbol
+		if symbol > TB_GEN_RUN+1 {
+			left = number[symbol-1]
+			right = left
+		} else if symbol == TB_GEN_RUN+1 {
+			left = number[common]
+			right = left
+		}
+		sizes = append(sizes, byte(left), byte(left>>8)|byte(right<<4), byte(right>>4))
+	}
+	if len(symbols)&1 != 0 {
+		sizes = append(sizes, 0)
+	}
+
+	//Fill the blocks with whole symbols
+	var (
+		blockBits   = 8 << TB_GEN_BLOCK_SIZE
+		blocks      []byte
+		blockLength []byte
+		firstValue  []int // First value index of each block
+		block       = make([]byte, blockBits/8)
+		used        = 0
+		inBlock     = 0
+		next        = 0
+	)
+	flush := func() {
+		blocks = append(blocks, block...)
+		blockLength = binary.LittleEndian.AppendUint16(blockLength, uint16(inBlock-1))
+		block = make([]byte, blockBits/8)
+		used, inBlock = 0, 0
+		firstValue = append(firstValue, next)
+	}
+	firstValue = append(firstValue, 0)
+	for _, token := range tokens {
+		length := lengths[token.symbol]
+		if used+length > blockBits || inBlock+token.count > 0x10000 {
+			flush()
+		}
+		code := base[length] + uint64(number[token.symbol]-lowest[length])
+		for b := length - 1; b >= 0; b-- {
+			if code>>b&1 != 0 {
+				block[used/8] |= 0x80 >> (used % 8)
+			}
+			used++
+		}
+		inBlock += token.count
+		next += token.count
+	}
+	flush()
+	firstValue = firstValue[:len(firstValue)-1]
+	binary.LittleEndian.PutUint32(sizes[4:], uint32(len(firstValue)))
+
+	//Sparse index: the block and offset of the value in the middle of each span. After the last value, the offsets
+	//go on in the last block
+	var (
+		span        = 1 << TB_GEN_SPAN
+		sparseIndex []byte
+	)
+	for k := 0; k*span < len(values); k++ {
+		idx := k*span + span/2
+		b := sort.Search(len(firstValue), func(b int) bool { return firstValue[b] > idx }) - 1
+		sparseIndex = binary.LittleEndian.AppendUint32(sparseIndex, uint32(b))
+		sparseIndex = binary.LittleEndian.AppendUint16(sparseIndex, uint16(idx-firstValue[b]))
+	}
+
+	return tbGenItem{sizes: sizes, sparseIndex: sparseIndex, blockLength: blockLength, blocks: blocks}
+}
+
+// Length of the Huffman code of each value
+func tbGenHuffman(freq map[int]int) map[int]int {
+	type node struct {
+		weight int
+		values []int
+	}
+	var nodes []node
+	for value, weight := range freq {
+		nodes = append(nodes, node{weight, []int{value}})
+	}
+	lengths := map[int]int{}
+	for len(nodes) > 1 {
+		sort.Slice(nodes, func(i, j int) bool {
+			if nodes[i].weight != nodes[j].weight {
+				return nodes[i].weight < nodes[j].weight
+			}
+			return nodes[i].values[0] < nodes[j].values[0]
+		})
+		merged := node{nodes[0].weight + nodes[1].weight, append(append([]int{}, nodes[0].values...), nodes[1].values...)}
+		for _, value := range merged.values {
+			lengths[value]++
+		}
+		nodes = append([]node{merged}, nodes[2:]...)
+	}
+	return lengths
+}
+
+func TestGenerateSyzygy(t *testing.T) {
+	if !*updateSyzygy {
+		t.Skip("run with -update-syzygy to regenerate the tables")
+	}
+
+	tables := []*tbGenTable{
+		newTBGenTable("KQvK", []int{WHITE_QUEEN, WHITE_KING, BLACK_KING}, true),
+		newTBGenTable("KRvK", []int{WHITE_ROOK, WHITE_KING, BLACK_KING}, true),
+		newTBGenTable("KPvK", []int{WHITE_PAWN, WHITE_KING, BLACK_KING}, true),
+		newTBGenTable("KNvKN", []int{WHITE_KING, BLACK_KING, WHITE_KNIGHT, BLACK_KNIGHT}, false),
+	}
+	solved := map[string]*tbGenTable{}
+	dir := filepath.Join("testdata", "syzygy")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gen := range tables {
+		solved[gen.name] = gen
+		gen.enumerate()
+		gen.successors(solved)
+		gen.solveWDL()
+		if err := gen.write(dir); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %d positions", gen.name, len(gen.pos))
+	}
+}
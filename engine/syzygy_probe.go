@@ -0,0 +1,288 @@
+package engine
+
+import (
+	"math/bits"
+)
+
+/*
+ * Probing of the Syzygy tablebases. The tables don't store the positions where the side to move has a winning (or
+ * drawing) capture exactly, the generator put there the value that compress best. So the captures are always searched
+ * first and the best of their results and of the table value is the real result. The DTZ tables also don't store the
+ * positions where the best move is a pawn move, and store only one side to move (the other side is found with a
+ * 1-ply search)
+ */
+
+// WDL results, from the side to move perspective
+const (
+	WDL_LOSS         = -2
+	WDL_BLESSED_LOSS = -1 // Loss, but drawn by the fifty-move rule
+	WDL_DRAW         = 0
+	WDL_CURSED_WIN   = 1 // Win, but drawn by the fifty-move rule
+	WDL_WIN          = 2
+)
+
+// State of a probe
+const (
+	TB_FAIL              = 0
+	TB_OK                = 1
+	TB_CHANGE_STM        = -1 // The DTZ table doesn't have this side to move
+	TB_ZEROING_BEST_MOVE = 2  // The best move is a capture or a pawn move
+)
+
+// Search score of a tablebase win, above any evaluation and below the mate score
+const TB_WIN = 20000
+
+// Rank of a root move that win right away (the rank go down with the distance to zeroing)
+const MAX_DTZ = 1 << 18
+
+// Check if the position is in the tablebases: standard chess, no castling and not too many pieces
+func (tb *Tablebase) CanProbe(chess *Chess) bool {
+	return chess.Variant == STANDARD && chess.CastlingPrivilege == 0 && bits.OnesCount64(chess.GenerateAllWhites()|chess.GenerateAllBlacks()) <= tb.MaxPieces
+}
+
+// Return the WDL result of the position, from the side to move perspective
+func (tb *Tablebase) ProbeWDL(chess *Chess) (int, bool) {
+	if !tb.CanProbe(chess) {
+		return WDL_DRAW, false
+	}
+	wdl, state := tb.searchWDL(chess, false)
+	return wdl, state != TB_FAIL
+}
+
+// Return the DTZ of the position in plies: positive when the side to move wins, negative when it loses, 0 for a draw.
+// A DTZ above 100 (or below -100) is a cursed win (or blessed loss)
+func (tb *Tablebase) ProbeDTZ(chess *Chess) (int, bool) {
+	if !tb.CanProbe(chess) {
+		return 0, false
+	}
+	dtz, state := tb.probeDTZ(chess)
+	return dtz, state != TB_FAIL
+}
+
+// Search the captures (and the pawn moves if checkZeroing is set) before probing the table
+func (tb *Tablebase) searchWDL(chess *Chess, checkZeroing bool) (int, int) {
+	var (
+		moves = chess.MoveGeneration()
+		best  = WDL_LOSS
+		count = 0
+	)
+
+	for _, move := range moves {
+		pawn := move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN
+		if !chess.IsCapture(move) && (!checkZeroing || !pawn) {
+			continue
+		}
+		count++
+
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		value, state := tb.searchWDL(clone, false)
+		if state == TB_FAIL {
+			return WDL_DRAW, TB_FAIL
+		}
+		if -value > best {
+			best = -value
+			if best >= WDL_WIN {
+				return best, TB_ZEROING_BEST_MOVE
+			}
+		}
+	}
+
+	//If all the moves were searched, the table value is not needed (and can be wrong, like with an en passant capture)
+	var (
+		noMoreMoves = count > 0 && count == len(moves)
+		value       = best
+	)
+	if !noMoreMoves {
+		var state int
+		value, state = tb.probeTable(chess, false, WDL_DRAW)
+		if state == TB_FAIL {
+			return WDL_DRAW, TB_FAIL
+		}
+	}
+
+	if best >= value {
+		if best > WDL_DRAW || noMoreMoves {
+			return best, TB_ZEROING_BEST_MOVE
+		}
+		return best, TB_OK
+	}
+	return value, TB_OK
+}
+
+func (tb *Tablebase) probeDTZ(chess *Chess) (int, int) {
+	wdl, state := tb.searchWDL(chess, true)
+	if state == TB_FAIL || wdl == WDL_DRAW {
+		return 0, state
+	}
+	if state == TB_ZEROING_BEST_MOVE {
+		return dtzBeforeZeroing(wdl), TB_OK
+	}
+
+	dtz, state := tb.probeTable(chess, true, wdl)
+	if state == TB_FAIL {
+		return 0, TB_FAIL
+	}
+	if state != TB_CHANGE_STM {
+		if wdl == WDL_CURSED_WIN || wdl == WDL_BLESSED_LOSS {
+			dtz += 100
+		}
+		return dtz * Sign(wdl), TB_OK
+	}
+
+	//The table has the other side to move: find the move with the best DTZ
+	minDTZ := 0xFFFF
+	for _, move := range chess.MoveGeneration() {
+		zeroing := chess.IsCapture(move) || move.FromBoard == WHITE_PAWN || move.FromBoard == BLACK_PAWN
+		clone := chess.Clone()
+		clone.MakeMove(move)
+
+		//For a zeroing move, the DTZ is the one before the move
+		var value int
+		if zeroing {
+			wdl, state = tb.searchWDL(clone, false)
+			value = -dtzBeforeZeroing(wdl)
+		} else {
+			value, state = tb.probeDTZ(clone)
+			value = -value
+		}
+		if state == TB_FAIL {
+			return 0, TB_FAIL
+		}
+
+		//A mating move
+		if value == 1 && clone.IsChecked() && len(clone.MoveGeneration()) == 0 {
+			minDTZ = 1
+		}
+		if !zeroing {
+			value += Sign(value)
+		}
+		if value < minDTZ && Sign(value) == Sign(wdl) {
+			minDTZ = value
+		}
+	}
+
+	//No legal move: the position is mate
+	if minDTZ == 0xFFFF {
+		return -1, TB_OK
+	}
+	return minDTZ, TB_OK
+}
+
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case WDL_WIN:
+		return 1
+	case WDL_CURSED_WIN:
+		return 101
+	case WDL_BLESSED_LOSS:
+		return -101
+	case WDL_LOSS:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Keep the root moves that preserve the best result. With the DTZ tables the moves are ranked by DTZ, so a win is
+// converted with the fastest moves to the next capture or pawn move (a win that would be too slow for the fifty-move
+// rule is ranked below the real wins). Without them, the moves are ranked by WDL. Return false if the position
+// cannot be probed
+func (tb *Tablebase) FilterRootMoves(chess *Chess, moves []Move) ([]Move, bool) {
+	if !tb.CanProbe(chess) || len(moves) == 0 {
+		return moves, false
+	}
+
+	ranks, ok := tb.rankDTZ(chess, moves)
+	if !ok {
+		if ranks, ok = tb.rankWDL(chess, moves); !ok {
+			return moves, false
+		}
+	}
+
+	best := ranks[0]
+	for _, rank := range ranks {
+		best = max(best, rank)
+	}
+	var filtered []Move
+	for i, move := range moves {
+		if ranks[i] == best {
+			filtered = append(filtered, move)
+		}
+	}
+
+	return filtered, true
+}
+
+func (tb *Tablebase) rankDTZ(chess *Chess, moves []Move) ([]int, bool) {
+	ranks := make([]int, len(moves))
+	for i, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+
+		var dtz, state int
+		if clone.Halfmove == 0 {
+			//After a zeroing move, the DTZ is only known from the WDL
+			var wdl int
+			wdl, state = tb.searchWDL(clone, false)
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			dtz, state = tb.probeDTZ(clone)
+			dtz = -dtz + Sign(-dtz)
+		}
+		if state == TB_FAIL {
+			return nil, false
+		}
+
+		//A mating move
+		if dtz == 2 && clone.IsChecked() && len(clone.MoveGeneration()) == 0 {
+			dtz = 1
+		}
+
+		switch {
+		case dtz > 0:
+			ranks[i] = MAX_DTZ - (dtz + chess.Halfmove)
+		case dtz < 0:
+			ranks[i] = -MAX_DTZ + (-dtz + chess.Halfmove)
+		}
+	}
+
+	return ranks, true
+}
+
+func (tb *Tablebase) rankWDL(chess *Chess, moves []Move) ([]int, bool) {
+	ranks := make([]int, len(moves))
+	for i, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		wdl, state := tb.searchWDL(clone, false)
+		if state == TB_FAIL {
+			return nil, false
+		}
+		ranks[i] = -wdl
+	}
+
+	return ranks, true
+}
+
+// Score of the position for the search, from the side to move perspective. The tablebases are only probed right after
+// a capture or a pawn move: the WDL doesn't know how many moves were played since the last one (fifty-move rule)
+func (chess *Chess) probeTablebase() (int, bool) {
+	tb := chess.Tablebase
+	if tb == nil || chess.Halfmove != 0 || !tb.CanProbe(chess) {
+		return 0, false
+	}
+
+	wdl, state := tb.searchWDL(chess, false)
+	if state == TB_FAIL {
+		return 0, false
+	}
+	switch wdl {
+	case WDL_WIN:
+		return TB_WIN, true
+	case WDL_LOSS:
+		return -TB_WIN, true
+	default:
+		return wdl, true // Drawn by the fifty-move rule, with a small preference for the cursed wins
+	}
+}
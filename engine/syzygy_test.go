@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tables of testdata/syzygy (see syzygy_gen_test.go): KQvK, KRvK, KPvK (WDL and DTZ) and KNvKN (WDL)
+func loadTestTablebase(t *testing.T) *Tablebase {
+	t.Helper()
+	tb, err := LoadTablebase(filepath.Join("testdata", "syzygy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+func TestSyzygyProbe(t *testing.T) {
+	tb := loadTestTablebase(t)
+	tests := []struct {
+		name string
+		fen  string
+		wdl  int
+		dtz  int
+	}{
+		{"KRvK mate in 1", "4k3/8/4K3/8/8/8/8/R7 w - - 0 1", WDL_WIN, 1},
+		{"KRvK mated", "R3k3/8/4K3/8/8/8/8/8 b - - 0 1", WDL_LOSS, -1},
+		{"KRvK rook taken", "8/8/8/8/8/2k5/1R6/7K b - - 0 1", WDL_DRAW, 0},
+		{"KRvK mate in 1, Rh8", "3k4/8/3K4/8/8/8/8/7R w - - 0 1", WDL_WIN, 1},
+		{"KRvK mated in 1", "7k/8/6K1/8/8/8/8/R7 b - - 0 1", WDL_LOSS, -2},
+		{"KQvK stalemate", "k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", WDL_DRAW, 0},
+		{"KQvK queen taken", "8/8/8/8/8/8/1kQ5/7K b - - 0 1", WDL_DRAW, 0},
+		{"KPvK promotion", "8/4P3/8/8/8/8/8/k3K3 w - - 0 1", WDL_WIN, 1},
+		{"KPvK opposition", "4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", WDL_LOSS, 0},
+		{"KPvK rook pawn", "k7/8/1K6/P7/8/8/8/8 w - - 0 1", WDL_DRAW, 0},
+
+		//Black has the material of the table: the colors are swapped
+		{"KvKR mate in 1", "r7/8/8/8/8/4k3/8/4K3 b - - 0 1", WDL_WIN, 1},
+		{"KvKR mated", "8/8/8/8/8/4k3/8/r3K3 w - - 0 1", WDL_LOSS, -1},
+		{"KvKP", "8/8/8/8/4p3/4k3/8/4K3 w - - 0 1", WDL_LOSS, 0},
+
+		//Symmetric table: only White to move is stored
+		{"KNvKN mate in 1", "kn6/8/1K6/3N4/8/8/8/8 w - - 0 1", WDL_WIN, 0},
+		{"KNvKN mate in 1, Black", "8/8/8/8/3n4/1k6/8/KN6 b - - 0 1", WDL_WIN, 0},
+		{"KNvKN draw", "8/8/3k4/8/8/3K4/3N4/3n4 w - - 0 1", WDL_DRAW, 0},
+		{"KNvKN draw, Black", "3N4/3n4/3k4/8/8/3K4/8/8 b - - 0 1", WDL_DRAW, 0},
+	}
+
+	for _, test := range tests {
+		chess := NewChess()
+		chess.FEN(test.fen)
+		if wdl, ok := tb.ProbeWDL(chess); !ok || wdl != test.wdl {
+			t.Errorf("%s: ProbeWDL() = %d %v, want %d", test.name, wdl, ok, test.wdl)
+		}
+		if !strings.Contains(test.name, "KNvKN") && test.dtz != 0 {
+			if dtz, ok := tb.ProbeDTZ(chess); !ok || dtz != test.dtz {
+				t.Errorf("%s: ProbeDTZ() = %d %v, want %d", test.name, dtz, ok, test.dtz)
+			}
+		}
+	}
+	if errors := tb.Errors(); len(errors) > 0 {
+		t.Errorf("Errors() = %v", errors)
+	}
+}
+
+// The WDL of KPvK must match the KPK bitbase, with White and with Black having the pawn
+func TestSyzygyKPvK(t *testing.T) {
+	tb := loadTestTablebase(t)
+	count := 0
+	for pawn := 8; pawn < 56; pawn++ {
+		for whiteKing := range 64 {
+			for blackKing := range 64 {
+				if whiteKing == pawn || blackKing == pawn || Distance(whiteKing, blackKing) <= 1 {
+					continue
+				}
+				for _, side := range []int{WHITE, BLACK} {
+					chess := NewChess()
+					SetBit(pawn, &chess.Boards[WHITE_PAWN])
+					SetBit(whiteKing, &chess.Boards[WHITE_KING])
+					SetBit(blackKing, &chess.Boards[BLACK_KING])
+					chess.SideToMove = side
+					chess.resetHash()
+					if side == WHITE && chess.IsBlackKingChecked() {
+						continue // Illegal position
+					}
+
+					want := WDL_DRAW
+					if winner, _ := chess.ProbeKPK(); winner == side {
+						want = WDL_WIN
+					} else if winner != 0 {
+						want = WDL_LOSS
+					}
+					if wdl, ok := tb.ProbeWDL(chess); !ok || wdl != want {
+						t.Fatalf("%s: ProbeWDL() = %d %v, want %d", chess.ToFEN(), wdl, ok, want)
+					}
+
+					//Every 7th position, the same with the colors swapped
+					if count++; count%7 == 0 {
+						chess.Flip()
+						if wdl, ok := tb.ProbeWDL(chess); !ok || wdl != want {
+							t.Fatalf("%s: ProbeWDL() = %d %v, want %d", chess.ToFEN(), wdl, ok, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// The longest KQvK mate is in 10 moves and the longest KRvK mate in 16 moves. Without captures or pawn moves,
+// the DTZ is the distance to mate in plies
+func TestSyzygyLongestDTZ(t *testing.T) {
+	tb := loadTestTablebase(t)
+	for _, test := range []struct {
+		piece int
+		dtz   int
+	}{{WHITE_QUEEN, 19}, {WHITE_ROOK, 31}} {
+		longest := 0
+		for piece := range 64 {
+			for whiteKing := range 64 {
+				for blackKing := range 64 {
+					if piece == whiteKing || piece == blackKing || whiteKing == blackKing || Distance(whiteKing, blackKing) <= 1 {
+						continue
+					}
+					chess := NewChess()
+					SetBit(piece, &chess.Boards[test.piece])
+					SetBit(whiteKing, &chess.Boards[WHITE_KING])
+					SetBit(blackKing, &chess.Boards[BLACK_KING])
+					chess.resetHash()
+					if chess.IsBlackKingChecked() {
+						continue
+					}
+					dtz, ok := tb.ProbeDTZ(chess)
+					if !ok {
+						t.Fatalf("%s: ProbeDTZ() failed", chess.ToFEN())
+					}
+					longest = max(longest, dtz)
+				}
+			}
+		}
+		if longest != test.dtz {
+			t.Errorf("longest DTZ with %s = %d, want %d", "PRNBQK"[test.piece:test.piece+1], longest, test.dtz)
+		}
+	}
+}
+
+func TestSyzygyFilterRootMoves(t *testing.T) {
+	tb := loadTestTablebase(t)
+	chess := NewChess()
+	chess.FEN("8/8/8/8/8/2k5/R7/4K3 w - - 0 1")
+
+	moves := chess.MoveGeneration()
+	filtered, ok := tb.FilterRootMoves(chess, moves)
+	if !ok || len(filtered) == 0 {
+		t.Fatalf("FilterRootMoves() = %v %v", filtered, ok)
+	}
+
+	//Only the winning moves with the fastest DTZ are kept: Rb2 and Rc2 lose the Rook
+	best := 0
+	for _, move := range moves {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		if dtz, _ := tb.ProbeDTZ(clone); dtz < 0 && (best == 0 || -dtz < best) {
+			best = -dtz
+		}
+	}
+	for _, move := range filtered {
+		clone := chess.Clone()
+		clone.MakeMove(move)
+		wdl, _ := tb.ProbeWDL(clone)
+		dtz, _ := tb.ProbeDTZ(clone)
+		if wdl != WDL_LOSS || -dtz != best {
+			t.Errorf("%s kept: WDL %d, DTZ %d, want a loss in %d", move.UCI(), wdl, dtz, best)
+		}
+		if move.UCI() == "a2b2" || move.UCI() == "a2c2" {
+			t.Errorf("%s kept, it lose the Rook", move.UCI())
+		}
+	}
+}
+
+// A corrupted file fails the probes, and is reported once by Errors
+func TestSyzygyErrors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "syzygy", "KRvK.rtbw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "KRvK.rtbw")
+	if err := os.WriteFile(path, data[:200], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "KQvK.rtbw"), []byte("not a table"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tb, err := LoadTablebase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fen := range []string{"4k3/8/4K3/8/8/8/8/R7 w - - 0 1", "4k3/8/4K3/8/8/8/8/Q7 w - - 0 1"} {
+		chess := NewChess()
+		chess.FEN(fen)
+		if wdl, ok := tb.ProbeWDL(chess); ok {
+			t.Errorf("%s: ProbeWDL() = %d, want a failure", fen, wdl)
+		}
+		tb.ProbeWDL(chess) // The file is only read once
+	}
+
+	errors := tb.Errors()
+	if len(errors) != 2 || !strings.Contains(errors[0].Error(), path) {
+		t.Errorf("Errors() = %v, want the errors of the 2 files", errors)
+	}
+	if errors := tb.Errors(); len(errors) != 0 {
+		t.Errorf("Errors() = %v after the errors were reported", errors)
+	}
+}
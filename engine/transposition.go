@@ -0,0 +1,76 @@
+package engine
+
+// Kind of score stored in a transposition table entry
+const (
+	TT_EXACT       = iota // The score is exact (PV node)
+	TT_LOWER_BOUND        // The search failed high, the real score is at least this score
+	TT_UPPER_BOUND        // The search failed low, the real score is at most this score
+)
+
+// Default number of entries of a transposition table (each entry is 72 bytes, so this is about 18 MB)
+const DEFAULT_TT_SIZE = 1 << 18
+
+type TTEntry struct {
+	Key   uint64
+	Depth int
+	Score int
+	Flag  int
+	Move  Move
+}
+
+// Transposition table: a fixed size hash table of search results indexed by the position hash.
+// It is not safe for concurrent use, every search that run at the same time need its own table
+type TranspositionTable struct {
+	entries []TTEntry
+}
+
+func NewTranspositionTable(size int) *TranspositionTable {
+	if size < 1 {
+		size = 1
+	}
+	return &TranspositionTable{
+		entries: make([]TTEntry, size),
+	}
+}
+
+// Return the entry of the position with the given hash, if the table has it
+func (tt *TranspositionTable) Probe(key uint64) (TTEntry, bool) {
+	entry := tt.entries[key%uint64(len(tt.entries))]
+	return entry, entry.Key == key && entry.Depth > 0
+}
+
+// Store a search result. We always replace, except when the slot already hold a deeper result of the same position
+func (tt *TranspositionTable) Store(key uint64, depth, score, flag int, move Move) {
+	entry := &tt.entries[key%uint64(len(tt.entries))]
+	if entry.Key == key && entry.Depth > depth {
+		return
+	}
+	*entry = TTEntry{Key: key, Depth: depth, Score: score, Flag: flag, Move: move}
+}
+
+// Mate scores are stored relative to the position (mate in n plies from it) instead of the root, so the entry is
+// still right when the position is reached at another ply
+func scoreToTT(score, ply int) int {
+	switch {
+	case score > MATE-MAX_MATE_PLY:
+		return score + ply
+	case score < -MATE+MAX_MATE_PLY:
+		return score - ply
+	}
+	return score
+}
+
+// Convert a stored score back to a score relative to the root, for a position at this ply
+func scoreFromTT(score, ply int) int {
+	switch {
+	case score > MATE-MAX_MATE_PLY:
+		return score - ply
+	case score < -MATE+MAX_MATE_PLY:
+		return score + ply
+	}
+	return score
+}
+
+func (tt *TranspositionTable) Clear() {
+	clear(tt.entries)
+}
@@ -106,6 +106,17 @@ func Abs(a int) int {
 	return a
 }
 
+func Sign(a int) int {
+	switch {
+	case a > 0:
+		return 1
+	case a < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
 func FlipVertical(bitboard uint64) uint64 {
 	return (bitboard << 56) | //Map from RANK 1 to RANK 8
 		((bitboard << 40) & RANK_MASK[6]) | //Map from RANK 2 to RANK 7
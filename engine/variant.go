@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+/*
+ * Chess variants. They keep the board and the moves of standard chess, and change how the game is won, where it
+ * starts from, or add moves:
+ * - King of the Hill: bringing the King to one of the 4 center squares also win the game
+ * - Three-check: checking the opponent's King 3 times also win the game. The checks given are part of the position
+ *   (and of its FEN)
+ * - Horde: White has 36 pawns and no King, and Black win by capturing all of them. The pawns of the first rank can
+ *   also move two squares (they can't be taken en passant)
+ * - Crazyhouse: the captured pieces can be dropped back on the board (see crazyhouse.go)
+ * - Atomic: the captures explode, and exploding the enemy King win the game (see atomic.go)
+ * A game that end by the variant rules has no legal moves left, and the side to move lost
+ */
+
+// Variant of the game played on the board
+type Variant int
+
+const (
+	STANDARD Variant = iota
+	KING_OF_THE_HILL
+	THREE_CHECK
+	HORDE
+	CRAZYHOUSE
+	ATOMIC
+)
+
+// Number of checks that win a Three-check game
+const THREE_CHECK_WIN = 3
+
+// The 4 center squares of King of the Hill: d4, e4, d5, e5
+const HILL_SQUARES uint64 = 0x0000001818000000
+
+// Evaluation of the variants, for White (it's mirrored for Black). Bonus of the King by its distance to the hill,
+// and bonus by the number of checks already given
+var (
+	hill_distance_mg  = [8]int{0, 120, 60, 25, 10, 0, 0, 0}
+	hill_distance_eg  = [8]int{0, 250, 120, 60, 25, 10, 0, 0}
+	three_check_bonus = [THREE_CHECK_WIN]int{0, 200, 600}
+)
+
+func (variant Variant) String() string {
+	switch variant {
+	case KING_OF_THE_HILL:
+		return "kingofthehill"
+	case THREE_CHECK:
+		return "3check"
+	case HORDE:
+		return "horde"
+	case CRAZYHOUSE:
+		return "crazyhouse"
+	case ATOMIC:
+		return "atomic"
+	default:
+		return "chess"
+	}
+}
+
+// Parse the name of a variant, as used by the UCI_Variant option (chess, kingofthehill, 3check, horde, crazyhouse,
+// atomic)
+func ParseVariant(name string) (Variant, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(name, "-", ""), " ", "")) {
+	case "chess", "standard", "":
+		return STANDARD, nil
+	case "kingofthehill", "koth":
+		return KING_OF_THE_HILL, nil
+	case "3check", "threecheck":
+		return THREE_CHECK, nil
+	case "horde":
+		return HORDE, nil
+	case "crazyhouse", "zh":
+		return CRAZYHOUSE, nil
+	case "atomic":
+		return ATOMIC, nil
+	}
+	return STANDARD, fmt.Errorf("unknown variant '%s'", name)
+}
+
+// FEN of the starting position of the variant
+func (variant Variant) StartFEN() string {
+	switch variant {
+	case THREE_CHECK:
+		return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1"
+	case HORDE:
+		return "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPPPPP w kq - 0 1"
+	case CRAZYHOUSE:
+		return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+	default:
+		return "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+	}
+}
+
+// Return the winner if the game is won by the rules of the variant (not by checkmate)
+func (chess *Chess) VariantWinner() (int, bool) {
+	switch chess.Variant {
+	case KING_OF_THE_HILL:
+		if chess.Boards[WHITE_KING]&HILL_SQUARES != 0 {
+			return WHITE, true
+		}
+		if chess.Boards[BLACK_KING]&HILL_SQUARES != 0 {
+			return BLACK, true
+		}
+	case THREE_CHECK:
+		if chess.Checks[0] >= THREE_CHECK_WIN {
+			return WHITE, true
+		}
+		if chess.Checks[1] >= THREE_CHECK_WIN {
+			return BLACK, true
+		}
+	case HORDE:
+		if chess.GenerateAllWhites() == 0 {
+			return BLACK, true
+		}
+	case ATOMIC:
+		if chess.Boards[BLACK_KING] == 0 {
+			return WHITE, true
+		}
+		if chess.Boards[WHITE_KING] == 0 {
+			return BLACK, true
+		}
+	}
+	return 0, false
+}
+
+// Check if the game is won by the rules of the variant. It's always won by the side that just moved
+func (chess *Chess) IsVariantEnd() bool {
+	if chess.Variant == STANDARD {
+		return false
+	}
+	_, over := chess.VariantWinner()
+	return over
+}
+
+// Update the state kept by the variant after a move: in Three-check, count the check given by the side that moved
+func (chess *Chess) updateVariantState() {
+	if chess.Variant != THREE_CHECK || !chess.IsChecked() {
+		return
+	}
+
+	side := 1
+	if chess.SideToMove == BLACK {
+		side = 0
+	}
+	chess.hashChecks(side, chess.Checks[side])
+	chess.Checks[side]++
+	chess.hashChecks(side, chess.Checks[side])
+}
+
+// Parse the checks of a Three-check FEN: remaining checks (3+3, after the en passant target) or checks given
+// (+0+0, at the end of the FEN). Return false if the field is not a check counter
+func (chess *Chess) parseChecks(field string) bool {
+	var white, black int
+	switch {
+	case strings.HasPrefix(field, "+"):
+		if _, err := fmt.Sscanf(field, "+%d+%d", &white, &black); err != nil {
+			return false
+		}
+	case strings.Contains(field, "+"):
+		if _, err := fmt.Sscanf(field, "%d+%d", &white, &black); err != nil {
+			return false
+		}
+		white, black = THREE_CHECK_WIN-white, THREE_CHECK_WIN-black
+	default:
+		return false
+	}
+
+	chess.Checks = [2]int{Max(Min(white, THREE_CHECK_WIN), 0), Max(Min(black, THREE_CHECK_WIN), 0)}
+	return true
+}
+
+// Evaluate the variant specific terms of one side: the King walk to the hill, the checks already given, the
+// missing King of the Horde, or the pieces in the pocket
+func (chess *Chess) evaluateVariant(e *evaluation, side int) {
+	switch chess.Variant {
+	case KING_OF_THE_HILL:
+		king := chess.Boards[WHITE_KING]
+		if side == BLACK {
+			king = chess.Boards[BLACK_KING]
+		}
+		if king == 0 {
+			return
+		}
+		distance := 7
+		index := bits.TrailingZeros64(king)
+		for hill := HILL_SQUARES; hill != 0; hill &= hill - 1 {
+			distance = Min(distance, Distance(index, bits.TrailingZeros64(hill)))
+		}
+		e.add("king of the hill", side, hill_distance_mg[distance], hill_distance_eg[distance])
+	case THREE_CHECK:
+		checks := chess.Checks[0]
+		if side == BLACK {
+			checks = chess.Checks[1]
+		}
+		e.addBonus("checks given", side, three_check_bonus[Min(checks, THREE_CHECK_WIN-1)])
+	case HORDE:
+		//The material of the Kings cancel out in standard chess, but the Horde has no King
+		if side == WHITE && chess.Boards[WHITE_KING] == 0 {
+			e.add("horde", side, e.params.MaterialMG[WHITE_KING], e.params.MaterialEG[WHITE_KING])
+		}
+	case CRAZYHOUSE:
+		//A piece in the pocket can be dropped anywhere, it's worth at least as much as on the board
+		pocket := chess.Pockets[0]
+		if side == BLACK {
+			pocket = chess.Pockets[1]
+		}
+		for piece, count := range pocket {
+			e.add("pocket", side, count*e.params.MaterialMG[piece], count*e.params.MaterialEG[piece])
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import "testing"
+
+func TestVariantPerft(t *testing.T) {
+	tests := []struct {
+		name    string
+		variant Variant
+		fen     string
+		nodes   []int // Perft from depth 1
+	}{
+		{"Horde start", HORDE, "", []int{8, 128, 1274, 23310, 265223}},
+		{"Horde", HORDE, "4k3/pp4q1/3P2p1/8/P3PP2/PPP2r2/PPP5/PPPP4 b - - 0 1", []int{30, 241, 6633, 56539}},
+		{"King of the Hill start", KING_OF_THE_HILL, "", []int{20, 400, 8902, 197281}},
+		{"King of the Hill, the King reach the hill", KING_OF_THE_HILL, "8/8/8/8/8/3K4/8/k7 w - - 0 1", []int{8, 15}},
+		{"King of the Hill, the game is over", KING_OF_THE_HILL, "rnbq1bnr/ppp2ppp/3k4/4p2Q/3PK3/8/PPP2PPP/RNB2BNR b - - 0 1", []int{0}},
+		{"Three-check start", THREE_CHECK, "", []int{20, 400, 8902, 197281}},
+		{"Three-check Kiwipete", THREE_CHECK, "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 1+1 0 1", []int{48, 2039, 97848}},
+	}
+
+	for _, test := range tests {
+		chess := NewChess()
+		chess.Variant = test.variant
+		chess.FEN(test.fen)
+		for depth, nodes := range test.nodes {
+			if count := chess.Perft(depth + 1); count != nodes {
+				t.Errorf("%s: Perft(%d) = %d, want %d", test.name, depth+1, count, nodes)
+			}
+		}
+	}
+}
+
+// The Horde has no King: the passed pawns of White are only scored by the distance to the black King
+func TestHordeKingless(t *testing.T) {
+	chess := NewChess()
+	chess.Variant = HORDE
+	chess.FEN("4k3/8/8/8/4P3/8/8/8 w - - 0 1")
+
+	var (
+		trace  = chess.EvaluateTrace()
+		params = chess.EvalParams()
+		want   = 2 * params.PassedPawnEnemyKing * Distance(FromAlgebraicToIndex("e8"), FromAlgebraicToIndex("e5"))
+	)
+	found := false
+	for _, term := range trace.Terms {
+		if term.Name == "passed pawn king distance" {
+			found = true
+			if term.White.EG != want || term.Black.EG != 0 {
+				t.Errorf("passed pawn king distance = %d %d, want %d 0", term.White.EG, term.Black.EG, want)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no passed pawn king distance term in %v", trace.Terms)
+	}
+
+	//The lone pawn is lost, but the search still play it
+	if _, move := chess.Search(4, -MATE, MATE); move.UCI() != "e4e5" {
+		t.Errorf("Search() = %s, want e4e5", move.UCI())
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"math/bits"
+	"math/rand"
+)
+
+// Zobrist keys used to hash a position: one key per (piece, square), one for Black to move,
+// one per castling privilege combination, one per en passant file, one per number of checks given (Three-check)
+// and one per number of pieces in the pockets (Crazyhouse)
+var (
+	zobristPiece     [12][64]uint64
+	zobristBlackMove uint64
+	zobristCastling  [16]uint64
+	zobristEnPassant [8]uint64
+	zobristChecks    [2][THREE_CHECK_WIN + 1]uint64
+	zobristPocket    [2][5][17]uint64 // Number of pieces of each type in the pocket of each side (Crazyhouse)
+)
+
+func init() {
+	//Fixed seed so the hash of a position is the same between runs
+	random := rand.New(rand.NewSource(0x5E41A))
+
+	for piece := WHITE_PAWN; piece <= BLACK_KING; piece++ {
+		for index := range 64 {
+			zobristPiece[piece][index] = random.Uint64()
+		}
+	}
+	zobristBlackMove = random.Uint64()
+	for i := range zobristCastling {
+		zobristCastling[i] = random.Uint64()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = random.Uint64()
+	}
+	for side := range zobristChecks {
+		for i := range zobristChecks[side] {
+			zobristChecks[side][i] = random.Uint64()
+		}
+	}
+	for side := range zobristPocket {
+		for piece := range zobristPocket[side] {
+			for i := range zobristPocket[side][piece] {
+				zobristPocket[side][piece][i] = random.Uint64()
+			}
+		}
+	}
+}
+
+/*
+ * The hash is updated incrementally by MakeMove. Since MoveGeneration flip the board in place,
+ * we also keep the hash of the flipped position (mirror) up to date, so Flip only need to swap both hashes
+ */
+
+// Return the Zobrist hash of the position
+func (chess *Chess) Hash() uint64 {
+	return chess.hash
+}
+
+// Calculate the Zobrist hash of the position and of the flipped position from scratch
+func (chess *Chess) ComputeHash() (uint64, uint64) {
+	var (
+		hash, mirror uint64
+		board        uint64
+		index        int
+	)
+
+	for piece := WHITE_PAWN; piece <= BLACK_KING; piece++ {
+		board = chess.Boards[piece]
+		for board != 0 {
+			index = bits.TrailingZeros64(board)
+			hash ^= zobristPiece[piece][index]
+			mirror ^= zobristPiece[(piece+6)%12][FlipIndexVertical(index)]
+			ClearBit(index, &board)
+		}
+	}
+
+	if chess.SideToMove == BLACK {
+		hash ^= zobristBlackMove
+	} else {
+		mirror ^= zobristBlackMove
+	}
+	hash ^= zobristCastling[chess.CastlingPrivilege&15]
+	mirror ^= zobristCastling[flipCastling(chess.CastlingPrivilege&15)]
+	if chess.EnPassantTarget != -1 {
+		hash ^= zobristEnPassant[chess.EnPassantTarget%8]
+		mirror ^= zobristEnPassant[chess.EnPassantTarget%8]
+	}
+	for side, checks := range chess.Checks {
+		if checks > 0 {
+			hash ^= zobristChecks[side][checks]
+			mirror ^= zobristChecks[1-side][checks]
+		}
+	}
+	for side := range chess.Pockets {
+		for piece, count := range chess.Pockets[side] {
+			if count > 0 {
+				hash ^= zobristPocket[side][piece][count]
+				mirror ^= zobristPocket[1-side][piece][count]
+			}
+		}
+	}
+
+	return hash, mirror
+}
+
+// Recalculate both hashes from scratch (after the position is set up directly, like in FEN)
+func (chess *Chess) resetHash() {
+	chess.hash, chess.mirror = chess.ComputeHash()
+}
+
+// Add or remove a piece from both hashes
+func (chess *Chess) hashPiece(piece, index int) {
+	chess.hash ^= zobristPiece[piece][index]
+	chess.mirror ^= zobristPiece[(piece+6)%12][FlipIndexVertical(index)]
+}
+
+// Update the hashes and the NNUE accumulators after a piece is added to or removed from its board
+func (chess *Chess) updatePiece(piece, index int) {
+	chess.hashPiece(piece, index)
+	if chess.accumulator != nil {
+		chess.accumulator.update(chess.network, piece, index, IsPieceAtIndex(chess.Boards[piece], index))
+	}
+}
+
+// Add or remove a castling privilege combination from both hashes
+func (chess *Chess) hashCastling(castling int) {
+	chess.hash ^= zobristCastling[castling&15]
+	chess.mirror ^= zobristCastling[flipCastling(castling&15)]
+}
+
+// Add or remove an en passant target from both hashes (the vertical flip keep the file)
+func (chess *Chess) hashEnPassant(enPassantTarget int) {
+	if enPassantTarget != -1 {
+		chess.hash ^= zobristEnPassant[enPassantTarget%8]
+		chess.mirror ^= zobristEnPassant[enPassantTarget%8]
+	}
+}
+
+// Add or remove the number of checks given by a side (0 for White, 1 for Black) from both hashes
+func (chess *Chess) hashChecks(side, checks int) {
+	if checks > 0 {
+		chess.hash ^= zobristChecks[side][checks]
+		chess.mirror ^= zobristChecks[1-side][checks]
+	}
+}
+
+// Add or remove the number of pieces of one type in the pocket of a side (0 for White, 1 for Black) from both hashes
+func (chess *Chess) hashPocket(side, piece, count int) {
+	if count > 0 {
+		chess.hash ^= zobristPocket[side][piece][count]
+		chess.mirror ^= zobristPocket[1-side][piece][count]
+	}
+}
+
+// Change the side to move in both hashes
+func (chess *Chess) hashSideToMove() {
+	chess.hash ^= zobristBlackMove
+	chess.mirror ^= zobristBlackMove
+}
+
+func flipCastling(castling int) int {
+	return ((castling >> 2) | (castling << 2)) & 15
+}
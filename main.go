@@ -8,7 +8,10 @@ import (
 	"os/exec"
 	"runtime"
 	"serina/engine"
+	"serina/tuner"
+	"serina/uci"
 	"serina/web-ui/server"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,6 +30,7 @@ func Clear() {
 func CLI() {
 	//Create chess instance
 	chess := engine.NewChess()
+	var book *engine.Book
 
 	//Run forever until user choose to stop
 	for {
@@ -57,6 +61,39 @@ func CLI() {
 			//Import FEN and display the chessboard
 			chess.FEN(fen)
 			fmt.Println(chess)
+		case "chess960":
+			//Get the index of the starting position from user
+			fmt.Print("Enter position (0-959, 518 is the standard one): ")
+			var index int
+			fmt.Scanf("%d\n", &index)
+
+			//Setup the starting position and display the chessboard
+			fen, err := engine.Chess960FEN(index)
+			if err != nil {
+				fmt.Printf("Error setting up the Chess960 position\nError: %v\n", err)
+				break
+			}
+			chess.FEN(fen)
+			fmt.Println(fen)
+			fmt.Println(chess)
+		case "variant":
+			//Get the variant from user
+			fmt.Print("Enter variant (chess, kingofthehill, 3check, horde, crazyhouse, atomic): ")
+			name, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+
+			//Play the variant from its starting position
+			variant, err := engine.ParseVariant(strings.TrimSpace(name))
+			if err != nil {
+				fmt.Printf("Error setting up the variant\nError: %v\n", err)
+				break
+			}
+			chess.Variant = variant
+			chess.FEN("")
+			fmt.Println(chess)
 		case "display":
 			//Display the chessboard
 			fmt.Println(chess)
@@ -102,6 +139,130 @@ func CLI() {
 			fmt.Printf("Took %d ms (%.2f seconds)\n", elapsed.Milliseconds(), elapsed.Seconds())
 		case "evaluate":
 			fmt.Println("Current position evaluation: ", chess.Evaluate())
+		case "eval":
+			//Print the breakdown of the evaluation by term
+			trace := chess.EvaluateTrace()
+			fmt.Println(trace.String())
+		case "load_eval":
+			//Get the evaluation parameters file from user
+			fmt.Print("Enter file path (empty for the built-in parameters): ")
+			path, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			path = strings.TrimSpace(path)
+
+			//Load the parameters and use them for this position
+			if path == "" {
+				chess.Params = nil
+				fmt.Println("Using the built-in evaluation parameters")
+				break
+			}
+			params, err := engine.LoadEvalParams(path)
+			if err != nil {
+				fmt.Printf("Error loading evaluation parameters\nError: %v\n", err)
+				break
+			}
+			chess.Params = params
+			fmt.Println("Evaluation parameters loaded from", path)
+		case "load_nnue":
+			//Get the network file from user
+			fmt.Print("Enter network file path (empty for the handcrafted evaluation): ")
+			path, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			path = strings.TrimSpace(path)
+
+			//Load the network and use it instead of the handcrafted evaluation
+			if path == "" {
+				chess.SetNetwork(nil)
+				fmt.Println("Using the handcrafted evaluation")
+				break
+			}
+			network, err := engine.LoadNetwork(path)
+			if err != nil {
+				fmt.Printf("Error loading network\nError: %v\n", err)
+				break
+			}
+			chess.SetNetwork(network)
+			fmt.Println("NNUE network loaded from", path)
+		case "load_syzygy":
+			//Get the tablebase directories from user
+			fmt.Print("Enter tablebase directories (empty for no tablebases): ")
+			path, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			path = strings.TrimSpace(path)
+
+			//Load the tablebases and probe them in the search
+			if path == "" {
+				chess.Tablebase = nil
+				fmt.Println("Tablebases disabled")
+				break
+			}
+			tablebase, err := engine.LoadTablebase(path)
+			if err != nil {
+				fmt.Printf("Error loading tablebases\nError: %v\n", err)
+				break
+			}
+			chess.Tablebase = tablebase
+			fmt.Printf("Found %d tablebase files, up to %d pieces\n", tablebase.Files, tablebase.MaxPieces)
+		case "save_eval":
+			//Get the file path from user
+			fmt.Print("Enter file path: ")
+			path, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			path = strings.TrimSpace(path)
+
+			//Save the current evaluation parameters
+			if err := chess.EvalParams().Save(path); err != nil {
+				fmt.Printf("Error saving evaluation parameters\nError: %v\n", err)
+				break
+			}
+			fmt.Println("Evaluation parameters saved to", path)
+		case "load_book":
+			//Get the book file from user
+			fmt.Print("Enter Polyglot book file path (empty for no book): ")
+			path, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			path = strings.TrimSpace(path)
+
+			if path == "" {
+				book = nil
+				fmt.Println("Opening book disabled")
+				break
+			}
+			book, err = engine.LoadBook(path)
+			if err != nil {
+				fmt.Printf("Error loading book\nError: %v\n", err)
+				break
+			}
+			fmt.Printf("Book loaded with %d entries\n", book.Size())
+		case "book":
+			//Print the book moves of the position with their weights
+			if book == nil {
+				fmt.Println("No book loaded, use load_book first")
+				break
+			}
+			moves := book.Moves(chess)
+			if len(moves) == 0 {
+				fmt.Println("The position is not in the book")
+				break
+			}
+			for _, move := range moves {
+				fmt.Printf("%s: %d\n", chess.SAN(move.Move), move.Weight)
+			}
 		case "search":
 			//Get the depth from user
 			fmt.Print("Enter depth: ")
@@ -114,6 +275,63 @@ func CLI() {
 			elapsed := time.Since(start)
 			fmt.Println("Found move: ", searchedMove)
 			fmt.Printf("Took %d ms (%.2f seconds)\n", elapsed.Milliseconds(), elapsed.Seconds())
+		case "analyze":
+			//Get the depth and the number of lines from user
+			fmt.Print("Enter depth: ")
+			var depth, multiPV int
+			fmt.Scanf("%d\n", &depth)
+			fmt.Print("Enter number of lines (MultiPV): ")
+			fmt.Scanf("%d\n", &multiPV)
+
+			//Perform MultiPV search and print the ranked lines
+			start := time.Now()
+			lines := chess.MultiPV(depth, multiPV)
+			elapsed := time.Since(start)
+			for i, line := range lines {
+				fmt.Printf("%d. %s (%s): %s\n", i+1, line.Move, uci.FormatScore(line.Score), uci.FormatPV(line.PV))
+			}
+			fmt.Printf("Took %d ms (%.2f seconds)\n", elapsed.Milliseconds(), elapsed.Seconds())
+		case "searchmoves":
+			//Get the depth and the root moves to search from user
+			fmt.Print("Enter depth: ")
+			var depth int
+			fmt.Scanf("%d\n", &depth)
+			fmt.Print("Enter moves (separated by spaces): ")
+			str, err := reader.ReadString('\n')
+			if err != nil {
+				fmt.Printf("Error reading from standard input\nError: %v\n", err)
+				os.Exit(1)
+			}
+			moves, err := chess.ParseRootMoves(strings.Fields(str))
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+
+			//Search only the given moves and print each one with its score
+			start := time.Now()
+			lines := chess.SearchRootMoves(depth, moves)
+			elapsed := time.Since(start)
+			for i, line := range lines {
+				fmt.Printf("%d. %s (%s): %s\n", i+1, line.Move, uci.FormatScore(line.Score), uci.FormatPV(line.PV))
+			}
+			fmt.Printf("Took %d ms (%.2f seconds)\n", elapsed.Milliseconds(), elapsed.Seconds())
+		case "mate":
+			//Get the number of moves from user
+			fmt.Print("Enter number of moves: ")
+			var n int
+			fmt.Scanf("%d\n", &n)
+
+			//Perform mate search
+			start := time.Now()
+			line, found := chess.FindMate(n)
+			elapsed := time.Since(start)
+			if found {
+				fmt.Printf("Mate in %d: %s\n", (len(line)+1)/2, uci.FormatPV(line))
+			} else {
+				fmt.Printf("No mate in %d\n", n)
+			}
+			fmt.Printf("Took %d ms (%.2f seconds)\n", elapsed.Milliseconds(), elapsed.Seconds())
 		case "test":
 			//Get the depth from user
 			fmt.Print("Enter depth: ")
@@ -131,14 +349,120 @@ func CLI() {
 		case "exit":
 			return
 		}
+
+		//Report the tablebase files that could not be read by the command, it went on without them
+		if chess.Tablebase != nil {
+			for _, err := range chess.Tablebase.Errors() {
+				fmt.Printf("Error reading tablebases\nError: %v\n", err)
+			}
+		}
 	}
 }
 
+// Tune the evaluation parameters: tune <positions file> <output file> [iterations] [start parameters file]
+func Tune(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: serina tune <positions file> <output file> [iterations] [start parameters file]")
+		os.Exit(1)
+	}
+
+	iterations := 0
+	if len(args) >= 3 {
+		var err error
+		iterations, err = strconv.Atoi(args[2])
+		if err != nil || iterations < 0 {
+			fmt.Printf("Invalid number of iterations '%s'\n", args[2])
+			os.Exit(1)
+		}
+	}
+
+	params := engine.DefaultEvalParams()
+	if len(args) >= 4 {
+		var err error
+		params, err = engine.LoadEvalParams(args[3])
+		if err != nil {
+			fmt.Printf("Error loading evaluation parameters\nError: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	positions, err := tuner.LoadPositions(args[0])
+	if err != nil {
+		fmt.Printf("Error loading positions\nError: %v\n", err)
+		os.Exit(1)
+	}
+	if len(positions) == 0 {
+		fmt.Println("No position to tune with")
+		os.Exit(1)
+	}
+
+	//Find the scaling constant, then tune and save the parameters after every iteration
+	start := time.Now()
+	t := tuner.NewTuner(positions, params)
+	fmt.Printf("Loaded %d positions, tuning %d parameters\n", len(positions), t.Size())
+	fmt.Printf("K = %.3f, error = %.6f\n", t.FindK(), t.Error(t.K))
+	t.Tune(iterations, func(iteration int, e float64) {
+		if err := params.Save(args[1]); err != nil {
+			fmt.Printf("Error saving evaluation parameters\nError: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Iteration %d: error = %.6f (%.0f seconds)\n", iteration, e, time.Since(start).Seconds())
+	})
+	fmt.Println("Tuned parameters saved to", args[1])
+}
+
+// Build a Polyglot opening book from PGN files: book <output file> <PGN file>...
+func BuildBook(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: serina book <output file> <PGN file>...")
+		os.Exit(1)
+	}
+
+	builder := engine.NewBookBuilder(engine.BOOK_MAX_PLY)
+	count := 0
+	for _, path := range args[1:] {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error opening PGN file\nError: %v\n", err)
+			os.Exit(1)
+		}
+		games, err := engine.ReadPGN(file)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Error reading PGN file\nError: %v\n", err)
+			os.Exit(1)
+		}
+		for _, game := range games {
+			builder.Add(game)
+		}
+		count += len(games)
+	}
+
+	book := builder.Book()
+	if err := book.Save(args[0]); err != nil {
+		fmt.Printf("Error saving book\nError: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Book built from %d games with %d entries, saved to %s\n", count, book.Size(), args[0])
+}
+
 func main() {
-	if len(os.Args) == 1 {
+	switch {
+	case len(os.Args) == 1:
 		CLI()
-	} else {
+	case os.Args[1] == "uci":
+		uci.NewUCI(os.Stdin, os.Stdout).Run()
+	case os.Args[1] == "tune":
+		Tune(os.Args[2:])
+	case os.Args[1] == "book":
+		BuildBook(os.Args[2:])
+	default:
 		server := server.NewServer()
+		if path := os.Getenv("SERINA_BOOK"); path != "" {
+			if err := server.LoadBook(path); err != nil {
+				fmt.Printf("Error loading book\nError: %v\n", err)
+			}
+		}
 		server.Start()
 	}
 }
@@ -0,0 +1,256 @@
+package tuner
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"runtime"
+	"serina/engine"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * Texel tuning (https://www.chessprogramming.org/Texel%27s_Tuning_Method). Each position is labeled with the result
+ * of the game it come from (1 for a White win, 0.5 for a draw, 0 for a Black win). The quiescence score of the position
+ * is mapped to an expected result with a sigmoid, and the error is the mean squared difference with the real results.
+ * First the scaling constant K of the sigmoid is chosen to minimize the error with the current parameters,
+ * then each parameter is moved up and down by one step, and the change is kept if it reduce the error
+ */
+
+// Parameters that are not tuned: the phase weights must add up to engine.TOTAL_PHASE, and the average mobility
+// only shift the score of both sides by the same amount
+var fixed_params = map[string]bool{
+	"phase_weight":     true,
+	"mobility_average": true,
+}
+
+type Position struct {
+	chess  *engine.Chess
+	result float64 // Result of the game from White perspective: 1, 0.5 or 0
+}
+
+type Tuner struct {
+	positions  []Position
+	params     *engine.EvalParams
+	parameters []*int // Every tuned weight in params
+	K          float64
+}
+
+// Create a tuner for the given parameters. The parameters are modified in place while tuning
+func NewTuner(positions []Position, params *engine.EvalParams) *Tuner {
+	//The parameters change between evaluations, so the pawn structure must not be cached
+	params.DisableCache()
+	tuner := &Tuner{
+		positions: positions,
+		params:    params,
+		K:         1,
+	}
+	for _, position := range positions {
+		position.chess.Params = params
+	}
+	tuner.collectParameters()
+
+	return tuner
+}
+
+// Collect a pointer to every tuned integer of the parameters, using the JSON name of the fields
+func (tuner *Tuner) collectParameters() {
+	value := reflect.ValueOf(tuner.params).Elem()
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || fixed_params[name] {
+			continue
+		}
+		tuner.collect(value.Field(i), name)
+	}
+}
+
+func (tuner *Tuner) collect(value reflect.Value, name string) {
+	switch value.Kind() {
+	case reflect.Int:
+		tuner.parameters = append(tuner.parameters, value.Addr().Interface().(*int))
+	case reflect.Array:
+		for i := range value.Len() {
+			//The King is never captured, so its material value doesn't matter
+			if (name == "material_mg" || name == "material_eg") && i == engine.WHITE_KING {
+				continue
+			}
+			tuner.collect(value.Index(i), name)
+		}
+	}
+}
+
+// Load labeled positions from a file. Each line has a FEN and a game result, in one of the usual formats:
+// EPD with the result in a c9 opcode or in brackets, CSV (fen,result), or the result as the last field.
+// The result can be written as 1-0, 0-1, 1/2-1/2 or as 1.0, 0.5, 0.0
+func LoadPositions(path string) ([]Position, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		positions []Position
+		scanner   = bufio.NewScanner(file)
+		number    = 0
+	)
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fen, result, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+
+		chess := engine.NewChess()
+		chess.FEN(fen)
+		positions = append(positions, Position{chess: chess, result: result})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+// Split a line of a labeled positions file into the FEN and the result
+func ParseLine(line string) (string, float64, error) {
+	var fenPart, resultPart string
+	if index := strings.IndexAny(line, ",;[\""); index != -1 {
+		fenPart, resultPart = line[:index], line[index:]
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return "", 0, fmt.Errorf("missing result in '%s'", line)
+		}
+		fenPart, resultPart = strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+	}
+
+	//EPD only has the first 4 fields of a FEN, the move counters are kept only if they are there
+	fields := strings.Fields(fenPart)
+	if len(fields) < 4 {
+		return "", 0, fmt.Errorf("invalid FEN '%s'", fenPart)
+	}
+	fen := strings.Join(fields[:4], " ")
+	if len(fields) >= 6 && isNumber(fields[4]) && isNumber(fields[5]) {
+		fen += " " + fields[4] + " " + fields[5]
+	}
+
+	result := strings.Trim(resultPart, ",;[]\"' \t")
+	switch result {
+	case "1-0", "1.0", "1":
+		return fen, 1, nil
+	case "0-1", "0.0", "0":
+		return fen, 0, nil
+	case "1/2-1/2", "0.5":
+		return fen, 0.5, nil
+	}
+
+	return "", 0, fmt.Errorf("invalid result '%s'", result)
+}
+
+func isNumber(str string) bool {
+	_, err := strconv.Atoi(str)
+	return err == nil
+}
+
+// Expected result (from White perspective) of a position with the given score
+func Sigmoid(score, K float64) float64 {
+	return 1 / (1 + math.Pow(10, -K*score/400))
+}
+
+// Mean squared error between the results and the expected results, using the current parameters
+func (tuner *Tuner) Error(K float64) float64 {
+	var (
+		workers = runtime.NumCPU()
+		errors  = make([]float64, workers)
+		wg      sync.WaitGroup
+	)
+
+	//Each worker has its own part of the positions, so no position is used by 2 goroutines
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := worker; i < len(tuner.positions); i += workers {
+				position := tuner.positions[i]
+				score := position.chess.Quiescence(-math.MaxInt32, math.MaxInt32)
+				if position.chess.SideToMove == engine.BLACK {
+					score = -score
+				}
+				diff := position.result - Sigmoid(float64(score), K)
+				errors[worker] += diff * diff
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0.0
+	for _, err := range errors {
+		total += err
+	}
+	return total / float64(len(tuner.positions))
+}
+
+// Find the K that minimize the error with the current parameters (the error is convex in K, so we use a ternary search)
+func (tuner *Tuner) FindK() float64 {
+	low, high := 0.0, 5.0
+	for high-low > 0.001 {
+		m1, m2 := low+(high-low)/3, high-(high-low)/3
+		if tuner.Error(m1) < tuner.Error(m2) {
+			high = m2
+		} else {
+			low = m1
+		}
+	}
+	tuner.K = (low + high) / 2
+
+	return tuner.K
+}
+
+// Run the local search for at most the given number of iterations (0 for no limit), or until no parameter change
+// reduce the error. After each iteration, done is called with the iteration number and the error
+func (tuner *Tuner) Tune(iterations int, done func(iteration int, err float64)) float64 {
+	best := tuner.Error(tuner.K)
+
+	for iteration := 1; iterations == 0 || iteration <= iterations; iteration++ {
+		improved := false
+		for _, parameter := range tuner.parameters {
+			//Try one step up, then one step down
+			for _, step := range []int{1, -2} {
+				*parameter += step
+				if err := tuner.Error(tuner.K); err < best {
+					best, improved = err, true
+					break
+				}
+				if step == -2 {
+					*parameter++ //Restore the value
+				}
+			}
+		}
+
+		if done != nil {
+			done(iteration, best)
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return best
+}
+
+// Number of tuned parameters
+func (tuner *Tuner) Size() int {
+	return len(tuner.parameters)
+}
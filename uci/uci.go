@@ -0,0 +1,477 @@
+package uci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"serina/engine"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_DEPTH    = 5
+	DEFAULT_MULTI_PV = 1
+	MAX_MULTI_PV     = 256
+)
+
+// UCI protocol front-end. It read commands line by line from the input and write responses to the output.
+// Searches run on their own goroutine so 'stop', 'ponderhit' and 'isready' can be handled while the engine think
+type UCI struct {
+	chess    *engine.Chess
+	depth    int
+	multiPV  int
+	ponder   bool
+	book     *engine.Book // Opening book, nil for none
+	ownBook  bool         // Play the book moves instead of searching
+	bestBook bool         // Play the book move with the best weight instead of a weighted random one
+	chess960 bool         // Write castling as the King capturing its Rook (UCI_Chess960)
+	reader   *bufio.Scanner
+	writer   io.Writer
+
+	tt         *engine.TranspositionTable // Shared by all searches of the game, so pondering results are reused
+	job        *engine.SearchJob          // Current search (nil if no search was started)
+	searching  sync.WaitGroup
+	mutex      sync.Mutex    // Guard hold, ponderTime and the writer
+	hold       chan struct{} // In ponder and infinite mode, bestmove is only sent after this channel is closed
+	ponderTime time.Duration // Time to use once the ponder move is played (ponderhit)
+}
+
+func NewUCI(in io.Reader, out io.Writer) *UCI {
+	chess := engine.NewChess()
+	chess.FEN("")
+
+	return &UCI{
+		chess:   chess,
+		depth:   DEFAULT_DEPTH,
+		multiPV: DEFAULT_MULTI_PV,
+		reader:  bufio.NewScanner(in),
+		writer:  out,
+		tt:      engine.NewTranspositionTable(engine.DEFAULT_TT_SIZE),
+	}
+}
+
+func (uci *UCI) Send(format string, args ...any) {
+	uci.mutex.Lock()
+	defer uci.mutex.Unlock()
+	fmt.Fprintf(uci.writer, format+"\n", args...)
+}
+
+// Run the protocol loop until 'quit' or the end of input
+func (uci *UCI) Run() {
+	defer uci.StopSearch()
+
+	for uci.reader.Scan() {
+		fields := strings.Fields(uci.reader.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			uci.Send("id name Serina")
+			uci.Send("id author danglnh07")
+			uci.Send("option name MultiPV type spin default %d min 1 max %d", DEFAULT_MULTI_PV, MAX_MULTI_PV)
+			uci.Send("option name Ponder type check default false")
+			uci.Send("option name EvalFile type string default <empty>")
+			uci.Send("option name EvalNetwork type string default <empty>")
+			uci.Send("option name SyzygyPath type string default <empty>")
+			uci.Send("option name OwnBook type check default false")
+			uci.Send("option name BookFile type string default <empty>")
+			uci.Send("option name BookBestMove type check default false")
+			uci.Send("option name UCI_Chess960 type check default false")
+			uci.Send("option name UCI_Variant type combo default chess var chess var kingofthehill var 3check var horde var crazyhouse var atomic")
+			uci.Send("uciok")
+		case "isready":
+			uci.Send("readyok")
+		case "ucinewgame":
+			uci.StopSearch()
+			uci.chess.FEN("")
+			uci.tt.Clear()
+		case "setoption":
+			uci.StopSearch()
+			uci.HandleSetOption(fields[1:])
+		case "position":
+			uci.StopSearch()
+			uci.HandlePosition(fields[1:])
+		case "go":
+			uci.StopSearch()
+			uci.HandleGo(fields[1:])
+		case "stop":
+			uci.StopSearch()
+		case "ponderhit":
+			uci.HandlePonderHit()
+		case "d":
+			uci.Send("%s", uci.chess)
+		case "quit":
+			return
+		}
+	}
+}
+
+// setoption name <id> [value <x>]
+func (uci *UCI) HandleSetOption(args []string) {
+	var name, value []string
+	target := &name
+	for _, arg := range args {
+		switch arg {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, arg)
+		}
+	}
+
+	switch strings.ToLower(strings.Join(name, " ")) {
+	case "multipv":
+		n, err := strconv.Atoi(strings.Join(value, ""))
+		if err != nil || n < 1 || n > MAX_MULTI_PV {
+			uci.Send("info string invalid MultiPV value '%s'", strings.Join(value, " "))
+			return
+		}
+		uci.multiPV = n
+	case "ponder":
+		uci.ponder = strings.ToLower(strings.Join(value, "")) == "true"
+	case "evalfile":
+		//Evaluation parameters file, empty for the built-in parameters
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			uci.chess.Params = nil
+		} else {
+			params, err := engine.LoadEvalParams(path)
+			if err != nil {
+				uci.Send("info string cannot load evaluation parameters: %v", err)
+				return
+			}
+			uci.chess.Params = params
+		}
+
+		//Scores of the old parameters are not valid anymore
+		uci.tt.Clear()
+	case "evalnetwork":
+		//NNUE network file, empty for the handcrafted evaluation
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			uci.chess.SetNetwork(nil)
+		} else {
+			network, err := engine.LoadNetwork(path)
+			if err != nil {
+				uci.Send("info string cannot load network: %v", err)
+				return
+			}
+			uci.chess.SetNetwork(network)
+		}
+		uci.tt.Clear()
+	case "syzygypath":
+		//Tablebase directories (separated like the PATH), empty for no tablebases
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			uci.chess.Tablebase = nil
+		} else {
+			tablebase, err := engine.LoadTablebase(path)
+			if err != nil {
+				uci.Send("info string cannot load tablebases: %v", err)
+				return
+			}
+			uci.chess.Tablebase = tablebase
+			uci.Send("info string found %d tablebase files, up to %d pieces", tablebase.Files, tablebase.MaxPieces)
+		}
+		uci.tt.Clear()
+	case "ownbook":
+		uci.ownBook = strings.ToLower(strings.Join(value, "")) == "true"
+	case "bookfile":
+		//Polyglot book file, empty for no book
+		path := strings.Join(value, " ")
+		if path == "" || path == "<empty>" {
+			uci.book = nil
+			return
+		}
+		book, err := engine.LoadBook(path)
+		if err != nil {
+			uci.Send("info string cannot load book: %v", err)
+			return
+		}
+		uci.book = book
+		uci.Send("info string book loaded with %d entries", book.Size())
+	case "bookbestmove":
+		uci.bestBook = strings.ToLower(strings.Join(value, "")) == "true"
+	case "uci_chess960":
+		uci.chess960 = strings.ToLower(strings.Join(value, "")) == "true"
+	case "uci_variant":
+		//Start from the initial position of the variant, the search results under the old rules are dropped
+		variant, err := engine.ParseVariant(strings.Join(value, " "))
+		if err != nil {
+			uci.Send("info string %v", err)
+			return
+		}
+		uci.chess.Variant = variant
+		uci.chess.FEN("")
+		uci.tt.Clear()
+	default:
+		uci.Send("info string unknown option '%s'", strings.Join(name, " "))
+	}
+}
+
+// position [startpos | fen <fen>] [moves <move1> ... <moveN>]
+func (uci *UCI) HandlePosition(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	//Split the FEN part and the move list
+	moveIndex := len(args)
+	for i, arg := range args {
+		if arg == "moves" {
+			moveIndex = i
+			break
+		}
+	}
+
+	switch args[0] {
+	case "startpos":
+		uci.chess.FEN("")
+	case "fen":
+		uci.chess.FEN(strings.Join(args[1:moveIndex], " "))
+	default:
+		return
+	}
+
+	//Play the moves, stop at the first illegal one so the board never get corrupted
+	for i := moveIndex + 1; i < len(args); i++ {
+		move, err := uci.chess.ParseUCIMove(args[i])
+		if err != nil {
+			uci.Send("info string %v", err)
+			return
+		}
+		uci.chess.MakeMove(move)
+	}
+}
+
+// Keywords of the 'go' command, used to know where a 'searchmoves' list ends
+var goKeywords = map[string]bool{
+	"searchmoves": true, "ponder": true, "wtime": true, "btime": true, "winc": true, "binc": true,
+	"movestogo": true, "depth": true, "nodes": true, "mate": true, "movetime": true, "infinite": true,
+}
+
+// go [searchmoves <move1> ... <moveN>] [ponder] [wtime <x>] [btime <x>] [winc <x>] [binc <x>] [movestogo <x>]
+// [depth <x>] [mate <x>] [movetime <x>] [infinite]. The search is run with the current MultiPV option.
+// Without any limit, the search stop at the default depth
+func (uci *UCI) HandleGo(args []string) {
+	var (
+		limits                           = engine.SearchLimits{MultiPV: uci.multiPV}
+		searchMoves                      []string
+		ponder, infinite                 bool
+		wtime, btime, winc, binc, moveTo int
+		moveTime                         int
+	)
+
+	//Read the integer argument following a keyword
+	number := func(i int) int {
+		if i+1 < len(args) {
+			if n, err := strconv.Atoi(args[i+1]); err == nil {
+				return n
+			}
+		}
+		return 0
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "searchmoves":
+			for i+1 < len(args) && !goKeywords[args[i+1]] {
+				searchMoves = append(searchMoves, args[i+1])
+				i++
+			}
+		case "ponder":
+			ponder = true
+		case "infinite":
+			infinite = true
+		case "depth":
+			limits.Depth = number(i)
+		case "movetime":
+			moveTime = number(i)
+		case "wtime":
+			wtime = number(i)
+		case "btime":
+			btime = number(i)
+		case "winc":
+			winc = number(i)
+		case "binc":
+			binc = number(i)
+		case "movestogo":
+			moveTo = number(i)
+		case "mate":
+			limits.Mate = number(i)
+		}
+	}
+
+	if len(searchMoves) > 0 {
+		moves, err := uci.chess.ParseRootMoves(searchMoves)
+		if err != nil {
+			uci.Send("info string %v", err)
+			uci.Send("bestmove 0000")
+			return
+		}
+		limits.RootMoves = moves
+	}
+
+	//Play the book move right away, unless the GUI asked for something else than a normal search
+	if uci.ownBook && uci.book != nil && !ponder && !infinite && limits.Mate == 0 && len(searchMoves) == 0 {
+		if move, ok := uci.book.Probe(uci.chess, uci.bestBook); ok {
+			uci.Send("info string book move")
+			uci.Send("bestmove %s", uci.FormatMove(move))
+			return
+		}
+	}
+
+	//Calculate the time we can use for this move
+	var budget time.Duration
+	switch {
+	case moveTime > 0:
+		budget = time.Duration(moveTime) * time.Millisecond
+	case uci.chess.SideToMove == engine.WHITE && wtime > 0:
+		budget = TimeBudget(wtime, winc, moveTo)
+	case uci.chess.SideToMove == engine.BLACK && btime > 0:
+		budget = TimeBudget(btime, binc, moveTo)
+	}
+	if budget == 0 && limits.Depth == 0 && !infinite && !ponder {
+		limits.Depth = uci.depth
+	}
+
+	//When pondering, the time only start once the opponent play the expected move
+	var hold chan struct{}
+	if ponder || infinite {
+		hold = make(chan struct{})
+	} else {
+		limits.MoveTime = budget
+	}
+
+	job := engine.NewSearchJob(uci.chess, limits, uci.tt)
+	uci.mutex.Lock()
+	uci.job, uci.hold, uci.ponderTime = job, hold, budget
+	uci.mutex.Unlock()
+
+	uci.searching.Add(1)
+	go uci.Think(job, hold)
+}
+
+// Run the search job, report each iteration and send the best move (with the move to ponder on)
+func (uci *UCI) Think(job *engine.SearchJob, hold chan struct{}) {
+	defer uci.searching.Done()
+
+	lines := job.Run(func(info engine.SearchInfo) {
+		nps := int(float64(info.Nodes) / max(info.Time.Seconds(), 0.001))
+		for i, line := range info.Lines {
+			uci.Send("info depth %d multipv %d score %s nodes %d nps %d tbhits %d time %d pv %s", info.Depth, i+1,
+				FormatScore(line.Score), info.Nodes, nps, info.TBHits, info.Time.Milliseconds(), uci.FormatPV(line.PV))
+		}
+	})
+
+	//The tablebase files that could not be read are reported once, the search went on without them
+	if tb := uci.chess.Tablebase; tb != nil {
+		for _, err := range tb.Errors() {
+			uci.Send("info string %v", err)
+		}
+	}
+
+	//In ponder and infinite mode, the GUI must tell us (ponderhit or stop) before we send the best move
+	if hold != nil {
+		<-hold
+	}
+
+	if len(lines) == 0 {
+		uci.Send("bestmove 0000")
+		return
+	}
+	if ponderMove, ok := job.PonderMove(lines[0]); ok {
+		uci.Send("bestmove %s ponder %s", uci.FormatMove(lines[0].Move), uci.FormatMove(ponderMove))
+		return
+	}
+	uci.Send("bestmove %s", uci.FormatMove(lines[0].Move))
+}
+
+// Write a move in the notation expected by the GUI, which depend on the UCI_Chess960 option
+func (uci *UCI) FormatMove(move engine.Move) string {
+	if uci.chess960 {
+		return move.UCI960()
+	}
+	return move.UCI()
+}
+
+// Write a principal variation in the notation expected by the GUI
+func (uci *UCI) FormatPV(pv []engine.Move) string {
+	moves := make([]string, len(pv))
+	for i, move := range pv {
+		moves[i] = uci.FormatMove(move)
+	}
+	return strings.Join(moves, " ")
+}
+
+// The opponent played the expected move: the ponder search become a normal timed search
+func (uci *UCI) HandlePonderHit() {
+	uci.mutex.Lock()
+	defer uci.mutex.Unlock()
+
+	if uci.job == nil || uci.hold == nil {
+		return
+	}
+	if uci.ponderTime > 0 {
+		uci.job.SetDeadline(time.Now().Add(uci.ponderTime))
+	}
+	close(uci.hold)
+	uci.hold = nil
+}
+
+// Stop the current search (if any) and wait for its best move to be sent. When pondering,
+// the result is simply discarded by the GUI
+func (uci *UCI) StopSearch() {
+	uci.mutex.Lock()
+	if uci.job != nil {
+		uci.job.Stop()
+	}
+	if uci.hold != nil {
+		close(uci.hold)
+		uci.hold = nil
+	}
+	uci.mutex.Unlock()
+
+	uci.searching.Wait()
+}
+
+// Time to use for one move: an equal part of the remaining time (30 moves if the GUI doesn't tell us) plus most
+// of the increment, keeping a small margin for the communication with the GUI
+func TimeBudget(remaining, increment, movesToGo int) time.Duration {
+	if movesToGo <= 0 {
+		movesToGo = 30
+	}
+
+	budget := remaining/movesToGo + increment*3/4
+	budget = engine.Min(budget, remaining-50)
+	budget = engine.Max(budget, 10)
+
+	return time.Duration(budget) * time.Millisecond
+}
+
+// Format a search score as 'cp <x>' or 'mate <y>'. A mate score is MATE minus the number of plies to the mate
+func FormatScore(score int) string {
+	switch {
+	case engine.IsMateScore(score) && score > 0:
+		return fmt.Sprintf("mate %d", (engine.MATE-score+1)/2)
+	case engine.IsMateScore(score):
+		return fmt.Sprintf("mate -%d", (engine.MATE+score)/2)
+	default:
+		return fmt.Sprintf("cp %d", score)
+	}
+}
+
+func FormatPV(pv []engine.Move) string {
+	moves := make([]string, len(pv))
+	for i, move := range pv {
+		moves[i] = move.UCI()
+	}
+	return strings.Join(moves, " ")
+}
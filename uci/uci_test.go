@@ -0,0 +1,27 @@
+package uci
+
+import (
+	"serina/engine"
+	"testing"
+)
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		score int
+		want  string
+	}{
+		{35, "cp 35"},
+		{-120, "cp -120"},
+		{engine.TB_WIN, "cp 20000"},
+		{engine.MATE - 1, "mate 1"},
+		{engine.MATE - 3, "mate 2"},
+		{-engine.MATE + 2, "mate -1"},
+		{-engine.MATE + 6, "mate -3"},
+	}
+
+	for _, test := range tests {
+		if got := FormatScore(test.score); got != test.want {
+			t.Errorf("FormatScore(%d) = %q, want %q", test.score, got, test.want)
+		}
+	}
+}
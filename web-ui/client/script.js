@@ -15,7 +15,17 @@ let currentPosition = []; //Current board state
 let validMoves = []; // All valid moves for ONE piece (selected piece)
 let currentMoves = []; // Store current moves (all moves) from the latest API response
 let sideToMove = 'white'; // Track side to move
-let moveIndex = 0; // Track move history index
+let gameId = null; // ID of the game of this page on the server
+
+// Build the URL of an API endpoint, for the game of this page
+function apiUrl(path, params = {}) {
+    const url = new URL(`http://localhost:8080${path}`);
+    if (gameId) url.searchParams.set('game', gameId);
+    for (const [key, value] of Object.entries(params)) {
+        url.searchParams.set(key, value);
+    }
+    return url.toString();
+}
 
 // Generate board squares
 ranks.forEach(rank => {
@@ -99,6 +109,32 @@ function updateBoard(chessData) {
 
     // Update the list of current moves
     currentMoves = chessData.moves;
+
+    // Show the game result when the game is over
+    updateGameStatus(chessData.status, chessData.result);
+}
+
+// Function to show or hide the game end message
+function updateGameStatus(status, result) {
+    const gameStatus = document.getElementById('game-status');
+    const statusText = {
+        'checkmate': 'Checkmate',
+        'stalemate': 'Draw by stalemate',
+        'fifty-move': 'Draw by the fifty-move rule',
+        'repetition': 'Draw by threefold repetition',
+        'insufficient-material': 'Draw by insufficient material',
+        'timeout': 'Lost on time',
+        'resignation': 'Resignation'
+    };
+
+    if (!status || status === 'ongoing') {
+        gameStatus.style.display = 'none';
+        gameStatus.textContent = '';
+        return;
+    }
+
+    gameStatus.textContent = `${statusText[status] || status} (${result})`;
+    gameStatus.style.display = 'block';
 }
 
 // Function to clear highlights
@@ -241,34 +277,8 @@ async function handleSquareClick(event) {
     // If move is found (valid move), perform move
     if (move) {
         // Make request to API endpoint: /move?move=YOUR_MOVE
-        let url = `http://localhost:8080/move?move=${encodeURIComponent(move)}`
+        let url = apiUrl('/move', { move: move });
         fetchPosition(url);
-
-        // Insert move into history table
-        const moveNumber = Math.floor(moveIndex / 2) + 1;
-        const moveHtml = `
-            <span class="history-move" data-id="${moveIndex}">
-              <img src="./assets/${pieceMapping[piece]}.png" class="history-piece">
-              ${move}
-            </span>
-          `;
-        if (sideToMove === 'white') {
-            // White's move: create new row
-            const row = document.createElement('tr');
-            row.innerHTML = `
-              <th scope="row">${moveNumber}</th>
-              <td>${moveHtml}</td>
-              <td></td>
-            `;
-            historyBody.appendChild(row);
-        } else if (sideToMove === 'black') {
-            // Black's move: update last row
-            const lastRow = historyBody.lastElementChild;
-            if (lastRow) {
-                lastRow.cells[2].innerHTML = moveHtml;
-            }
-        }
-        moveIndex++;
     }
 }
 
@@ -284,33 +294,103 @@ async function fetchPosition(url) {
         updateBoard(data);
         clearHighlights(); // Clear any existing highlights
         selectedPiece = null; // Reset selected piece
-        // Clear history table
-        // historyBody.innerHTML = '';
-        // moveIndex = 0;
+        fetchHistory(); // The history table follow the game of the server
     } catch (error) {
         console.error('Error fetching position:', error);
         alert('Failed to load position. Please try again.');
     }
 }
 
+// Function to fetch the moves of the game and fill the history table
+async function fetchHistory() {
+    try {
+        const response = await fetch(apiUrl('/history'));
+        if (!response.ok) {
+            throw new Error('Failed to fetch history');
+        }
+        const data = await response.json();
+        updateHistory(data);
+    } catch (error) {
+        console.error('Error fetching history:', error);
+    }
+}
+
+// Function to fill the history table: one row by move number, the current move is highlighted and the undone moves
+// are greyed out. Clicking a move go to the position after it
+function updateHistory(history) {
+    const historyBody = document.getElementById('historyBody');
+    historyBody.innerHTML = '';
+
+    // The game can start with Black to move, then the first row has no White move
+    const fenFields = history.start_fen.split(' ');
+    const blackFirst = fenFields[1] === 'b';
+    let moveNumber = parseInt(fenFields[fenFields.length - 1]) || 1;
+    let row = null;
+
+    history.moves.forEach((move, index) => {
+        const isWhite = (index % 2 === 0) !== blackFirst;
+        if (isWhite || row === null) {
+            row = document.createElement('tr');
+            row.innerHTML = `<th scope="row">${moveNumber}</th><td></td><td></td>`;
+            historyBody.appendChild(row);
+            moveNumber++;
+        }
+
+        const cell = row.cells[isWhite ? 1 : 2];
+        const span = document.createElement('span');
+        span.classList.add('history-move');
+        if (move.ply === history.ply) span.classList.add('current');
+        if (move.ply > history.ply) span.classList.add('undone');
+        span.textContent = move.san;
+        span.addEventListener('click', () => fetchPosition(apiUrl('/goto', { ply: move.ply })));
+        cell.appendChild(span);
+    });
+}
+
 
-// Load default position on page load
+// Function to create the game of this page on the server, from the default position
+async function createGame() {
+    try {
+        const response = await fetch(apiUrl('/games'), { method: 'POST' });
+        if (!response.ok) {
+            throw new Error('Failed to create game');
+        }
+        const data = await response.json();
+        gameId = data.id;
+        updateBoard(data.position);
+        fetchHistory();
+    } catch (error) {
+        console.error('Error creating game:', error);
+        alert('Failed to create the game. Please reload the page.');
+    }
+}
+
+// Create a new game on page load
 window.addEventListener('load', () => {
-    fetchPosition('http://localhost:8080/fen');
+    createGame();
 });
 
 // Handle FEN button click
 document.getElementById('fen-btn').addEventListener('click', () => {
     const fen = prompt('Enter FEN string:');
     if (fen !== null) {
-        fetchPosition(`http://localhost:8080/fen?fen=${encodeURIComponent(fen)}`);
+        fetchPosition(apiUrl('/fen/', { fen: fen }));
     }
 });
 
+// Handle Undo and Redo button clicks
+document.getElementById('undo-btn').addEventListener('click', () => {
+    fetchPosition(apiUrl('/undo'));
+});
+
+document.getElementById('redo-btn').addEventListener('click', () => {
+    fetchPosition(apiUrl('/redo'));
+});
+
 // Handle Flip button click
 document.getElementById('flip-btn').addEventListener('click', () => {
     //ranks.reverse();
-    fetchPosition('http://localhost:8080/flip');
+    fetchPosition(apiUrl('/flip/'));
 });
 
 // Function to fetch Perft results
@@ -324,7 +404,7 @@ async function fetchPerft(depth) {
         // document.getElementById('time').textContent = '';
         perftModal.show();
 
-        const response = await fetch(`http://localhost:8080/perft?depth=${depth}`);
+        const response = await fetch(apiUrl('/perft', { depth: depth }));
         if (!response.ok) {
             throw new Error('Failed to fetch Perft results');
         }
@@ -363,12 +443,12 @@ async function fetchData(type, params = {}) {
         const typeConfig = {
             perft: {
                 title: 'Perft Results',
-                url: `http://localhost:8080/perft?depth=${params.depth || 0}`,
+                url: apiUrl('/perft', { depth: params.depth || 0 }),
                 display: displayPerftResults
             },
             search: {
                 title: 'Search Results',
-                url: `http://localhost:8080/search?depth=${params.depth || 0}`,
+                url: apiUrl('/search', { depth: params.depth || 0 }),
                 display: displaySearchResults
             }
         };
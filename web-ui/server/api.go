@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"serina/engine"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +19,42 @@ type ChessData struct {
 	Halfmove          int        `json:"halfmove"`
 	Fullmove          int        `json:"fullmove"`
 	Moves             []string   `json:"moves"`
+	Status            string     `json:"status"`           // ongoing, checkmate, stalemate, fifty-move, repetition, ...
+	Result            string     `json:"result"`           // 1-0, 0-1, 1/2-1/2, or * for an ongoing game
+	Variant           string     `json:"variant"`          // chess, kingofthehill, 3check, horde, crazyhouse or atomic
+	Checks            [2]int     `json:"checks,omitempty"` // Checks given by White and Black in Three-check
+	Pocket            string     `json:"pocket,omitempty"` // Pieces in hand in Crazyhouse, White in uppercase (QRbn)
+	FEN               string     `json:"fen"`
+}
+
+// Find the game of the request ('game' parameter) and lock it, the caller must unlock it. If there is no such game,
+// the error is sent and nil is returned
+func (server *Server) lockSession(w http.ResponseWriter, r *http.Request) *Session {
+	id := r.URL.Query().Get("game")
+	if id == "" {
+		http.Error(w, "Missing request parameter 'game'", http.StatusBadRequest)
+		return nil
+	}
+	session, ok := server.games.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown game '%s'", id), http.StatusNotFound)
+		return nil
+	}
+
+	session.mutex.Lock()
+	return session
+}
+
+// Copy the position of the game of the request, for the handlers that only read it (search, perft, evaluation).
+// The game is unlocked right away: a long search doesn't block the other requests, and the moves generation, which
+// flip the board in place, never run on the position of the game. Return nil if the error was sent
+func (server *Server) snapshot(w http.ResponseWriter, r *http.Request) *engine.Chess {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return nil
+	}
+	defer session.mutex.Unlock()
+	return session.game.Position().Clone()
 }
 
 func NewChessData(chess *engine.Chess) *ChessData {
@@ -50,20 +87,128 @@ func NewChessData(chess *engine.Chess) *ChessData {
 		chessData.Moves = append(chessData.Moves, move.String())
 	}
 	// chessData.Moves = chess.MoveGeneration()
+	result := chess.Result()
+	chessData.Status = result.Status.String()
+	chessData.Result = result.String()
+	chessData.Variant = chess.Variant.String()
+	chessData.FEN = chess.ToFEN()
+	switch chess.Variant {
+	case engine.THREE_CHECK:
+		chessData.Checks = chess.Checks
+	case engine.CRAZYHOUSE:
+		chessData.Pocket = chess.Pocket()
+	}
 
 	return chessData
 }
 
+type GameResult struct {
+	ID       string     `json:"id"`
+	Position *ChessData `json:"position"`
+}
+
+// POST /games?variant=<name>&fen=<FEN> create a game (both parameters are optional), DELETE /games?game=<id> remove it
+func (server *Server) HandleGames(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		variant, err := engine.ParseVariant(r.FormValue("variant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fen := r.FormValue("fen")
+		if err := engine.ValidateFEN(variant, fen); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		game := engine.NewGame(variant, fen)
+		id, err := server.games.Create(game)
+		if err == ErrTooManyGames {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error creating game ID\nError: %v\n", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		//Send the data back as JSON
+		data, err := json.MarshalIndent(GameResult{ID: id, Position: NewChessData(game.Position())}, "", "")
+		if err != nil {
+			fmt.Printf("Error marshaling game to JSON\nError: %v\n", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(data))
+	case http.MethodDelete:
+		id := r.URL.Query().Get("game")
+		if !server.games.Delete(id) {
+			http.Error(w, fmt.Sprintf("Unknown game '%s'", id), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Add("Allow", "POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func (server *Server) HandleFEN(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
 	//Get the FEN string from request
 	params := r.URL.Query()
 	fen := params.Get("fen")
 
-	//Setup the chessboard using the FEN string and get its array representation
-	server.chess.FEN(fen)
+	//Start a new game from the FEN string, keeping the variant
+	variant := session.game.Position().Variant
+	if err := engine.ValidateFEN(variant, fen); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	session.game = engine.NewGame(variant, fen)
+
+	//Send the data back as JSON
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(data))
+}
+
+func (server *Server) HandleVariant(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//Get the variant from request
+	params := r.URL.Query()
+	variant, err := engine.ParseVariant(params.Get("variant"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//Start a new game of the variant
+	session.game = engine.NewGame(variant, "")
 
 	//Send the data back as JSON
-	data, err := json.MarshalIndent(NewChessData(server.chess), "", "")
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
 	if err != nil {
 		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -76,10 +221,19 @@ func (server *Server) HandleFEN(w http.ResponseWriter, r *http.Request) {
 }
 
 func (server *Server) HandleFlipBoard(w http.ResponseWriter, r *http.Request) {
-	server.chess.Flip()
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//The flipped position start a new game
+	flipped := session.game.Position().Clone()
+	flipped.Flip()
+	session.game = engine.NewGame(flipped.Variant, flipped.ToFEN())
 
 	//Send the data back as JSON
-	data, err := json.MarshalIndent(NewChessData(server.chess), "", "")
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
 	if err != nil {
 		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -91,16 +245,79 @@ func (server *Server) HandleFlipBoard(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(data))
 }
 
+type MoveError struct {
+	Error      string   `json:"error"`
+	Move       string   `json:"move"`
+	LegalMoves []string `json:"legal_moves"` // Legal moves of the position, in the notation of ChessData.Moves
+}
+
 func (server *Server) HandleMove(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
 	//Get the move from URL
 	params := r.URL.Query()
 	move := params.Get("move")
 
+	//Find the legal move matching the string (UCI, SAN, or O-O and o-o-o), the position is left unchanged otherwise
+	chess := session.game.Position()
+	legalMove, err := chess.ParseMove(move)
+	if err != nil {
+		data := MoveError{Error: err.Error(), Move: move, LegalMoves: []string{}}
+		if move == "" {
+			data.Error = "Missing request parameter 'move'"
+		}
+		for _, legal := range chess.MoveGeneration() {
+			data.LegalMoves = append(data.LegalMoves, legal.String())
+		}
+
+		jsonData, err := json.MarshalIndent(data, "", "")
+		if err != nil {
+			fmt.Printf("Error marshaling move error to JSON\nError: %v\n", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(jsonData))
+		return
+	}
+
 	//Perform the move
-	server.chess.MakeMove(engine.NewMove(server.chess, move))
+	session.game.Play(legalMove)
+
+	//Send the data back as JSON
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(data))
+}
+
+func (server *Server) HandleUndo(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//Take back the last move
+	if !session.game.Undo() {
+		http.Error(w, "No move to undo", http.StatusBadRequest)
+		return
+	}
 
 	//Send the data back as JSON
-	data, err := json.MarshalIndent(NewChessData(server.chess), "", "")
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
 	if err != nil {
 		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -112,6 +329,117 @@ func (server *Server) HandleMove(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(data))
 }
 
+func (server *Server) HandleRedo(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//Play again the last move undone
+	if !session.game.Redo() {
+		http.Error(w, "No move to redo", http.StatusBadRequest)
+		return
+	}
+
+	//Send the data back as JSON
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(data))
+}
+
+func (server *Server) HandleGoTo(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//Get the ply from URL, 0 for the starting position
+	params := r.URL.Query()
+	if params.Get("ply") == "" {
+		http.Error(w, "Missing request parameter 'ply'", http.StatusBadRequest)
+		return
+	}
+	ply, err := strconv.Atoi(params.Get("ply"))
+	if err != nil {
+		http.Error(w, "Invalid request parameter 'ply'", http.StatusBadRequest)
+		return
+	}
+	if err := session.game.GoTo(ply); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//Send the data back as JSON
+	data, err := json.MarshalIndent(NewChessData(session.game.Position()), "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling chessboard array to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(data))
+}
+
+type HistoryMove struct {
+	Ply  int       `json:"ply"` // Number of moves played after this one, from 1
+	Move string    `json:"move"`
+	SAN  string    `json:"san"`
+	FEN  string    `json:"fen"` // Position after the move
+	Time time.Time `json:"time"`
+}
+
+type HistoryResult struct {
+	StartFEN string        `json:"start_fen"`
+	Ply      int           `json:"ply"` // Moves played to reach the current position, the ones after it can be redone
+	Moves    []HistoryMove `json:"moves"`
+}
+
+func (server *Server) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	session := server.lockSession(w, r)
+	if session == nil {
+		return
+	}
+	defer session.mutex.Unlock()
+
+	//Get the moves of the game, including the ones undone
+	data := HistoryResult{
+		StartFEN: session.game.StartFEN,
+		Ply:      session.game.Ply,
+		Moves:    []HistoryMove{},
+	}
+	for i, move := range session.game.Moves {
+		data.Moves = append(data.Moves, HistoryMove{
+			Ply:  i + 1,
+			Move: move.Move.String(),
+			SAN:  move.SAN,
+			FEN:  move.FEN,
+			Time: move.Time,
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling game history to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(jsonData))
+}
+
 type PerftResult struct {
 	Result    map[string]int `json:"result"`
 	TotalNode int            `json:"total_node"`
@@ -133,8 +461,12 @@ func (server *Server) HandlePerft(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//Get the perft result
+	chess := server.snapshot(w, r)
+	if chess == nil {
+		return
+	}
 	start := time.Now()
-	result, totalNode := server.chess.FastPerft(depth)
+	result, totalNode := chess.FastPerft(depth)
 	elapsed := time.Since(start)
 
 	//Send the data back as JSON
@@ -159,6 +491,7 @@ func (server *Server) HandlePerft(w http.ResponseWriter, r *http.Request) {
 type SearchResult struct {
 	SearchedMove string `json:"searched_move"`
 	Time         int    `json:"time"`
+	Book         bool   `json:"book,omitempty"` // The move comes from the opening book
 }
 
 func (server *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
@@ -175,15 +508,29 @@ func (server *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Get the search result
+	//Play from the opening book while the position is in it, otherwise get the search result
+	chess := server.snapshot(w, r)
+	if chess == nil {
+		return
+	}
 	start := time.Now()
-	_, searchedMove := server.chess.Search(depth, -math.MaxInt32, math.MaxInt32)
+	var (
+		searchedMove engine.Move
+		inBook       bool
+	)
+	if server.book != nil {
+		searchedMove, inBook = server.book.Probe(chess, false)
+	}
+	if !inBook {
+		_, searchedMove = chess.Search(depth, -math.MaxInt32, math.MaxInt32)
+	}
 	elapsed := time.Since(start)
 
 	//Send the data back as JSON
 	data := SearchResult{
 		SearchedMove: searchedMove.String(),
 		Time:         int(elapsed.Milliseconds()),
+		Book:         inBook,
 	}
 
 	jsonData, err := json.MarshalIndent(data, "", "")
@@ -197,3 +544,155 @@ func (server *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(jsonData))
 }
+
+type AnalysisLine struct {
+	Move  string   `json:"move"`
+	Score int      `json:"score"`
+	PV    []string `json:"pv"`
+}
+
+type AnalysisResult struct {
+	Lines   []AnalysisLine `json:"lines"`
+	Time    int            `json:"time"`
+	Bitbase string         `json:"bitbase,omitempty"` // Exact result of a KPK position: 1-0, 0-1 or 1/2-1/2
+}
+
+func (server *Server) HandleAnalyze(w http.ResponseWriter, r *http.Request) {
+	//Get the depth and the number of lines from URL
+	params := r.URL.Query()
+	if params.Get("depth") == "" {
+		http.Error(w, "Missing request parameter 'depth'", http.StatusBadRequest)
+		return
+	}
+	depth, err := strconv.Atoi(params.Get("depth"))
+	if err != nil {
+		http.Error(w, "Invalid request parameter 'depth'", http.StatusBadRequest)
+		return
+	}
+
+	multiPV := 1
+	if params.Get("multipv") != "" {
+		multiPV, err = strconv.Atoi(params.Get("multipv"))
+		if err != nil || multiPV < 1 {
+			http.Error(w, "Invalid request parameter 'multipv'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	//Get the ranked lines. If a list of moves is given, only those root moves are searched and each one get its own score
+	chess := server.snapshot(w, r)
+	if chess == nil {
+		return
+	}
+	var (
+		lines []engine.Line
+		start = time.Now()
+	)
+	if params.Get("moves") != "" {
+		moves, err := chess.ParseRootMoves(strings.Split(params.Get("moves"), ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lines = chess.SearchRootMoves(depth, moves)
+		if len(lines) > multiPV && params.Get("multipv") != "" {
+			lines = lines[:multiPV]
+		}
+	} else {
+		lines = chess.MultiPV(depth, multiPV)
+	}
+	elapsed := time.Since(start)
+
+	//Send the data back as JSON
+	data := AnalysisResult{
+		Lines: []AnalysisLine{},
+		Time:  int(elapsed.Milliseconds()),
+	}
+	for _, line := range lines {
+		analysisLine := AnalysisLine{Move: line.Move.String(), Score: line.Score}
+		for _, move := range line.PV {
+			analysisLine.PV = append(analysisLine.PV, move.String())
+		}
+		data.Lines = append(data.Lines, analysisLine)
+	}
+	if winner, ok := chess.ProbeKPK(); ok {
+		switch winner {
+		case engine.WHITE:
+			data.Bitbase = "1-0"
+		case engine.BLACK:
+			data.Bitbase = "0-1"
+		default:
+			data.Bitbase = "1/2-1/2"
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling analysis result to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(jsonData))
+}
+
+type EvaluationScore struct {
+	MG int `json:"mg"`
+	EG int `json:"eg"`
+}
+
+type EvaluationTerm struct {
+	Name  string          `json:"name"`
+	White EvaluationScore `json:"white"`
+	Black EvaluationScore `json:"black"`
+}
+
+type EvaluationResult struct {
+	Terms   []EvaluationTerm `json:"terms"`
+	MG      int              `json:"mg"`
+	EG      int              `json:"eg"`
+	Bonus   int              `json:"bonus"`
+	Phase   int              `json:"phase"`
+	Score   int              `json:"score"`             // From White perspective
+	Endgame string           `json:"endgame,omitempty"` // Known ending that replaced or scaled the score
+}
+
+func (server *Server) HandleEvaluate(w http.ResponseWriter, r *http.Request) {
+	//Get the breakdown of the evaluation of the current position
+	chess := server.snapshot(w, r)
+	if chess == nil {
+		return
+	}
+	trace := chess.EvaluateTrace()
+
+	//Send the data back as JSON
+	data := EvaluationResult{
+		Terms:   []EvaluationTerm{},
+		MG:      trace.MG,
+		EG:      trace.EG,
+		Bonus:   trace.Bonus,
+		Phase:   trace.Phase,
+		Score:   trace.Score,
+		Endgame: trace.Endgame,
+	}
+	for _, term := range trace.Terms {
+		data.Terms = append(data.Terms, EvaluationTerm{
+			Name:  term.Name,
+			White: EvaluationScore{MG: term.White.MG, EG: term.White.EG},
+			Black: EvaluationScore{MG: term.Black.MG, EG: term.Black.EG},
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "")
+	if err != nil {
+		fmt.Printf("Error marshaling evaluation to JSON\nError: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(jsonData))
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"serina/engine"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestServer() *Server {
+	server := NewServer()
+	server.Config()
+	return server
+}
+
+// Send a request to the server and return the response
+func request(server *Server, method, path string, params url.Values) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.mux.ServeHTTP(recorder, httptest.NewRequest(method, path+"?"+params.Encode(), nil))
+	return recorder
+}
+
+// Create a game and return its ID
+func createGame(t *testing.T, server *Server, params url.Values) string {
+	t.Helper()
+	recorder := request(server, http.MethodPost, "/games", params)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("POST /games = %d %s", recorder.Code, recorder.Body.String())
+	}
+	var result GameResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.ID
+}
+
+func TestInvalidFEN(t *testing.T) {
+	server := newTestServer()
+	for _, fen := range []string{"8/8/8", "8/8/8/8/8/8/8/8 w - - 0 1", "4k3/8/8/8/8/8/8/4K3 x - - 0 1"} {
+		recorder := request(server, http.MethodPost, "/games", url.Values{"fen": {fen}})
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "invalid FEN") {
+			t.Errorf("POST /games?fen=%s = %d %s, want 400", fen, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	//The game keep its position after an invalid FEN
+	id := createGame(t, server, url.Values{"variant": {"horde"}})
+	recorder := request(server, http.MethodGet, "/fen/", url.Values{"game": {id}, "fen": {"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("GET /fen/ = %d %s, want 400", recorder.Code, recorder.Body.String())
+	}
+	recorder = request(server, http.MethodGet, "/fen/", url.Values{"game": {id}, "fen": {"8/8/8"}})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("GET /fen/ = %d %s, want 400", recorder.Code, recorder.Body.String())
+	}
+	session, _ := server.games.Get(id)
+	if fen := session.game.Position().ToFEN(); fen != engine.HORDE.StartFEN() {
+		t.Errorf("position after the invalid FENs = %s, want %s", fen, engine.HORDE.StartFEN())
+	}
+
+	recorder = request(server, http.MethodGet, "/fen/", url.Values{"game": {id}, "fen": {"4k3/8/8/8/8/8/PPPPPPPP/8 b - - 0 1"}})
+	if recorder.Code != http.StatusOK {
+		t.Errorf("GET /fen/ = %d %s, want 200", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestTooManyGames(t *testing.T) {
+	server := newTestServer()
+	server.games.maxGames = 1
+	createGame(t, server, nil)
+	if recorder := request(server, http.MethodPost, "/games", nil); recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /games on a full server = %d, want 503", recorder.Code)
+	}
+}
+
+// Requests from many goroutines, on the same game and on different games. Run with -race
+func TestConcurrentRequests(t *testing.T) {
+	const (
+		KIWIPETE = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+		READERS  = 4
+		FLIPS    = 10 // Even, so the board is back to its position
+	)
+	var (
+		server = newTestServer()
+		first  = createGame(t, server, nil)
+		second = createGame(t, server, url.Values{"fen": {KIWIPETE}})
+		moves  = []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1c4", "g8f6", "d2d3", "f8c5"}
+		wg     sync.WaitGroup
+	)
+
+	//Expected position after the moves
+	chess := engine.NewChess()
+	chess.FEN("")
+	for _, str := range moves {
+		move, err := chess.ParseUCIMove(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chess.MakeMove(move)
+	}
+	played := chess.ToFEN()
+
+	expect := func(method, path string, params url.Values, code int) {
+		if recorder := request(server, method, path, params); recorder.Code != code {
+			t.Errorf("%s %s?%s = %d %s, want %d", method, path, params.Encode(), recorder.Code, recorder.Body.String(), code)
+		}
+	}
+	spawn := func(method, path string, params url.Values, code int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			expect(method, path, params, code)
+		}()
+	}
+	readers := func(id string) {
+		for range READERS {
+			spawn(http.MethodGet, "/perft", url.Values{"game": {id}, "depth": {"2"}}, http.StatusOK)
+			spawn(http.MethodGet, "/search", url.Values{"game": {id}, "depth": {"2"}}, http.StatusOK)
+			spawn(http.MethodGet, "/analyze", url.Values{"game": {id}, "depth": {"2"}, "multipv": {"2"}}, http.StatusOK)
+			spawn(http.MethodGet, "/evaluate", url.Values{"game": {id}}, http.StatusOK)
+			spawn(http.MethodGet, "/history", url.Values{"game": {id}}, http.StatusOK)
+			spawn(http.MethodGet, "/history", url.Values{"game": {"unknown"}}, http.StatusNotFound)
+		}
+	}
+
+	//The moves of the first game are played in order while the other requests run, and the second game is flipped
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, move := range moves {
+			expect(http.MethodGet, "/move", url.Values{"game": {first}, "move": {move}}, http.StatusOK)
+		}
+	}()
+	for range FLIPS {
+		spawn(http.MethodGet, "/flip/", url.Values{"game": {second}}, http.StatusOK)
+	}
+	readers(first)
+	readers(second)
+	wg.Wait()
+	checkPosition(t, server, first, played, len(moves))
+	checkPosition(t, server, second, KIWIPETE, 0)
+
+	//Every move is undone once, then redone once
+	for range moves {
+		spawn(http.MethodGet, "/undo", url.Values{"game": {first}}, http.StatusOK)
+	}
+	readers(first)
+	wg.Wait()
+	expect(http.MethodGet, "/undo", url.Values{"game": {first}}, http.StatusBadRequest)
+	checkPosition(t, server, first, engine.STANDARD.StartFEN(), 0)
+
+	for range moves {
+		spawn(http.MethodGet, "/redo", url.Values{"game": {first}}, http.StatusOK)
+	}
+	readers(first)
+	wg.Wait()
+	expect(http.MethodGet, "/redo", url.Values{"game": {first}}, http.StatusBadRequest)
+	checkPosition(t, server, first, played, len(moves))
+}
+
+// Check the position of a game, and its ply in the history
+func checkPosition(t *testing.T, server *Server, id, fen string, ply int) {
+	t.Helper()
+	recorder := request(server, http.MethodGet, "/history", url.Values{"game": {id}})
+	var history HistoryResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &history); err != nil {
+		t.Fatalf("GET /history = %d %s", recorder.Code, recorder.Body.String())
+	}
+	if history.Ply != ply {
+		t.Errorf("ply = %d, want %d", history.Ply, ply)
+	}
+
+	session, _ := server.games.Get(id)
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if position := session.game.Position().ToFEN(); position != fen {
+		t.Errorf("position = %s, want %s", position, fen)
+	}
+}
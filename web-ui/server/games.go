@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"serina/engine"
+	"sync"
+	"time"
+)
+
+// Time a game is kept after its last request, and how often the expired games are removed
+const (
+	GAME_TTL              = time.Hour
+	GAME_CLEANUP_INTERVAL = time.Minute
+)
+
+// Maximum number of games kept at once, so the clients can't fill the memory of the server
+const MAX_GAMES = 10000
+
+// Error of Create when the registry is full
+var ErrTooManyGames = errors.New("too many games, try again later")
+
+// A game of the registry. The handlers hold its mutex while they use the game, so a game is used by one request
+// at a time while the other games stay available
+type Session struct {
+	mutex    sync.Mutex
+	game     *engine.Game
+	lastUsed time.Time
+}
+
+// Games of the server by ID: every client plays and analyzes its own game
+type Registry struct {
+	mutex    sync.Mutex
+	games    map[string]*Session
+	ttl      time.Duration
+	maxGames int
+}
+
+func NewRegistry(ttl time.Duration, maxGames int) *Registry {
+	return &Registry{
+		games:    map[string]*Session{},
+		ttl:      ttl,
+		maxGames: maxGames,
+	}
+}
+
+// Add a game to the registry and return its ID. When the registry is full, the expired games are removed first,
+// and ErrTooManyGames is returned if there is still no room
+func (registry *Registry) Create(game *engine.Game) (string, error) {
+	//Random IDs, so a client can't guess the games of the others
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(bytes)
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if len(registry.games) >= registry.maxGames && registry.removeExpired() == 0 {
+		return "", ErrTooManyGames
+	}
+	registry.games[id] = &Session{game: game, lastUsed: time.Now()}
+	return id, nil
+}
+
+// Find a game by its ID. Using a game keep it alive for another TTL
+func (registry *Registry) Get(id string) (*Session, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	session, ok := registry.games[id]
+	if ok {
+		session.lastUsed = time.Now()
+	}
+	return session, ok
+}
+
+// Remove a game, return false if it doesn't exist
+func (registry *Registry) Delete(id string) bool {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	_, ok := registry.games[id]
+	delete(registry.games, id)
+	return ok
+}
+
+// Remove the games that were not used for a TTL, and return how many were removed. A request still using a
+// removed game can finish with it
+func (registry *Registry) Cleanup() int {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	return registry.removeExpired()
+}
+
+// Remove the expired games, the registry must be locked
+func (registry *Registry) removeExpired() int {
+	removed := 0
+	for id, session := range registry.games {
+		if time.Since(session.lastUsed) > registry.ttl {
+			delete(registry.games, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Remove the expired games at every interval, forever
+func (registry *Registry) RunCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		registry.Cleanup()
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"serina/engine"
+	"testing"
+	"time"
+)
+
+// A full registry refuse new games until a game expire or is deleted
+func TestRegistryLimit(t *testing.T) {
+	registry := NewRegistry(time.Hour, 2)
+	first, err := registry.Create(engine.NewGame(engine.STANDARD, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Create(engine.NewGame(engine.STANDARD, "")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Create(engine.NewGame(engine.STANDARD, "")); err != ErrTooManyGames {
+		t.Fatalf("Create() on a full registry = %v, want ErrTooManyGames", err)
+	}
+
+	registry.Delete(first)
+	if _, err := registry.Create(engine.NewGame(engine.STANDARD, "")); err != nil {
+		t.Fatalf("Create() after Delete() = %v", err)
+	}
+
+	//The expired games make room
+	registry.ttl = 0
+	if _, err := registry.Create(engine.NewGame(engine.STANDARD, "")); err != nil {
+		t.Fatalf("Create() with expired games = %v", err)
+	}
+	if len(registry.games) != 1 {
+		t.Errorf("%d games, want 1", len(registry.games))
+	}
+}
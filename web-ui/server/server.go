@@ -6,34 +6,56 @@ import (
 	"serina/engine"
 )
 
+// Web UI server. Requests can run concurrently: a game is locked by the requests that read or change it (one at a
+// time for each game), while the search, perft and evaluation run on a copy of the position once it's unlocked
 type Server struct {
 	mux   *http.ServeMux
-	chess *engine.Chess
+	games *Registry    // Games of the clients, by ID
+	book  *engine.Book // Opening book used for the engine moves, nil for none
 }
 
 func NewServer() *Server {
 	return &Server{
 		mux:   http.NewServeMux(),
-		chess: engine.NewChess(),
+		games: NewRegistry(GAME_TTL, MAX_GAMES),
 	}
 }
 
+// Load the Polyglot opening book used for the engine moves
+func (server *Server) LoadBook(path string) error {
+	book, err := engine.LoadBook(path)
+	if err != nil {
+		return err
+	}
+	server.book = book
+	return nil
+}
+
 func (server *Server) Config() {
 	//Setup file server
 	fileSrv := http.Dir("./web-ui/client")
 	server.mux.Handle("/assets/", http.StripPrefix("/assets", http.FileServer(http.Dir("./web-ui/client/assets"))))
 	server.mux.Handle("/", http.FileServer(fileSrv))
 
-	//Setup API endpoint
+	//Setup API endpoint. Except /games, which create and delete the games, they all take the game ID ('game' parameter)
+	server.mux.HandleFunc("/games", server.HandleGames)
 	server.mux.HandleFunc("/fen/", server.HandleFEN)
+	server.mux.HandleFunc("/variant", server.HandleVariant)
 	server.mux.HandleFunc("/flip/", server.HandleFlipBoard)
 	server.mux.HandleFunc("/move", server.HandleMove)
+	server.mux.HandleFunc("/undo", server.HandleUndo)
+	server.mux.HandleFunc("/redo", server.HandleRedo)
+	server.mux.HandleFunc("/goto", server.HandleGoTo)
+	server.mux.HandleFunc("/history", server.HandleHistory)
 	server.mux.HandleFunc("/perft", server.HandlePerft)
 	server.mux.HandleFunc("/search", server.HandleSearch)
+	server.mux.HandleFunc("/analyze", server.HandleAnalyze)
+	server.mux.HandleFunc("/evaluate", server.HandleEvaluate)
 }
 
 func (server *Server) Start() {
 	server.Config()
+	go server.games.RunCleanup(GAME_CLEANUP_INTERVAL)
 
 	fmt.Println("Server start at http://localhost:8080 ...")
 	err := http.ListenAndServe(":8080", server.mux)